@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+
+	"gin_CRUD_server/db"
+	"gin_CRUD_server/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DBStatsURL = "/admin/db/stats"
+	VarsURL    = "/debug/vars"
+	DBStatsVar = "db"
+)
+
+// registerAdminRoutes registers the routes of the DB statistics, they require the db.stats permission
+func (s *Server) registerAdminRoutes(router *gin.Engine) {
+	admin := router.Group("", s.RequireAuth, RequirePermission(models.PermissionReadDBStats))
+	admin.GET(DBStatsURL, s.DBStatsHandler)
+	admin.GET(VarsURL, s.VarsHandler)
+}
+
+// DBStatsHandler returns the statistics of the connection pool of the DB (in use, idle, wait count...)
+func (s *Server) DBStatsHandler(ctx *gin.Context) {
+	pool, ok := db.Unwrap(s.DB).(db.PoolStatsProvider)
+	if !ok {
+		abortWithProblem(ctx, models.CodeNotImplemented, "the DB has no connection pool")
+		return
+	}
+	ctx.JSON(http.StatusOK, pool.PoolStats())
+}
+
+// VarsHandler returns the statistics of the connection pool as the db variable with the memory
+// statistics of the process, like the expvar variables but without the command line and its secrets
+func (s *Server) VarsHandler(ctx *gin.Context) {
+	vars := gin.H{}
+	if pool, ok := db.Unwrap(s.DB).(db.PoolStatsProvider); ok {
+		vars[DBStatsVar] = pool.PoolStats()
+	}
+	memStats := runtime.MemStats{}
+	runtime.ReadMemStats(&memStats)
+	vars["memstats"] = memStats
+	ctx.JSON(http.StatusOK, vars)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"gin_CRUD_server/db"
+	"gin_CRUD_server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// poolMapOps is a map DB with the statistics of a connection pool
+type poolMapOps struct {
+	db.TestMapOps
+}
+
+// PoolStats returns fixed statistics of the connection pool
+func (poolMapOps) PoolStats() db.PoolStats {
+	return db.PoolStats{MaxOpenConnections: 10, OpenConnections: 3, InUse: 2, Idle: 1, WaitCount: 4}
+}
+
+func TestDBStatsHandler(t *testing.T) {
+	mapDB := db.NewTestMapOps("Map DB Stats Test")
+	for _, email := range []string{TestEmail, AdminEmail} {
+		mapDB.InsertNewUser(context.Background(), *models.NewUser(email, "bari", "1234"))
+	}
+	tests := []struct {
+		name      string
+		dbOps     models.DBOps
+		url       string
+		email     string
+		wantCode  int
+		wantStats *db.PoolStats
+	}{
+		{"Gets the pool statistics as admin successfully", poolMapOps{mapDB}, DBStatsURL, AdminEmail, http.StatusOK, &db.PoolStats{MaxOpenConnections: 10, OpenConnections: 3, InUse: 2, Idle: 1, WaitCount: 4}},
+		{"Gets the vars as admin successfully", poolMapOps{mapDB}, VarsURL, AdminEmail, http.StatusOK, nil},
+		{"Gets fail due to member user", poolMapOps{mapDB}, DBStatsURL, TestEmail, http.StatusForbidden, nil},
+		{"Gets the vars fail due to member user", poolMapOps{mapDB}, VarsURL, TestEmail, http.StatusForbidden, nil},
+		{"Gets the vars without pool successfully", mapDB, VarsURL, AdminEmail, http.StatusOK, nil},
+		{"Gets fail due to DB without connection pool", mapDB, DBStatsURL, AdminEmail, http.StatusNotImplemented, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, tt.dbOps)
+			server.Admins = newAdmins(AdminEmail)
+			require.NoError(t, server.GrantAdmins(context.Background()))
+			respRecorder, router := createRouterAndWriter()
+			server.registerRoutes(router)
+			request, _ := createNewRequest(http.MethodGet, tt.url, "", nil)
+			request.Header.Set("Authorization", BearerPrefix+newUserToken(server, tt.email, nil))
+			router.ServeHTTP(respRecorder, request)
+			assert.Equal(t, tt.wantCode, respRecorder.Code)
+			if tt.wantStats != nil {
+				stats := db.PoolStats{}
+				assert.NoError(t, json.Unmarshal(respRecorder.Body.Bytes(), &stats))
+				assert.Equal(t, *tt.wantStats, stats)
+			}
+			if tt.url == VarsURL && tt.wantCode == http.StatusOK {
+				// Only the pool and memory statistics are served, not the command line and its secrets
+				vars := map[string]json.RawMessage{}
+				assert.NoError(t, json.Unmarshal(respRecorder.Body.Bytes(), &vars))
+				assert.Contains(t, vars, "memstats")
+				assert.NotContains(t, vars, "cmdline")
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+
+	"gin_CRUD_server/models"
+	"github.com/gin-gonic/gin"
+)
+
+const AuditURL = ListURL + "/:id/audit"
+
+// UserAuditHandler returns the audit entries of the user of the path from the oldest, the entries of
+// a deleted user are still returned according to its ID
+func (s *Server) UserAuditHandler(ctx *gin.Context) {
+	id := idFromPath(ctx)
+	if !models.IsUserID(id) {
+		user, ok := s.getUserFromPath(ctx)
+		if !ok {
+			return
+		}
+		id = user.ID
+	}
+	entries, err := s.DB.GetUserAudit(ctx.Request.Context(), id)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	if len(entries) == 0 {
+		// The users are audited since their creation, an unknown user has no entries
+		if _, err = s.DB.GetUserByID(ctx.Request.Context(), id); err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		entries = []models.AuditEntry{}
+	}
+	ctx.JSON(http.StatusOK, entries)
+}
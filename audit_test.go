@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gin_CRUD_server/db"
+	"gin_CRUD_server/logging"
+	"gin_CRUD_server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserAuditHandler(t *testing.T) {
+	mapDB := db.NewTestMapOps("Map DB Audit Test")
+	for _, email := range []string{TestEmail, AdminEmail, "deleted@gmail.com"} {
+		require.NoError(t, mapDB.InsertNewUser(context.Background(), *models.NewUser(email, "bari", "1234")))
+	}
+	user, _ := mapDB.IsExistsInUsersTable(context.Background(), TestEmail)
+	admin, _ := mapDB.IsExistsInUsersTable(context.Background(), AdminEmail)
+	deleted, _ := mapDB.IsExistsInUsersTable(context.Background(), "deleted@gmail.com")
+	require.NoError(t, mapDB.DeleteUser(context.Background(), deleted.Email))
+	server := newTestServer(t, mapDB)
+	server.Admins = newAdmins(AdminEmail)
+	require.NoError(t, server.GrantAdmins(context.Background()))
+	respRecorder, router := createRouterAndWriter()
+	server.registerRoutes(router)
+
+	// The admin renames the user, the change is audited with the admin as its actor
+	request, _ := createNewRequest(http.MethodPatch, V1UsersURL+"/"+user.ID, models.MergePatchContentType, strings.NewReader(`{"name": "bari2"}`))
+	request.Header.Set("Authorization", BearerPrefix+newUserToken(server, AdminEmail, nil))
+	request.Header.Set(RequestIDHeader, "audit-request")
+	request.RemoteAddr = "10.0.0.1:4321"
+	router.ServeHTTP(respRecorder, request)
+	require.Equal(t, http.StatusOK, respRecorder.Code)
+
+	tests := []struct {
+		name        string
+		id          string
+		email       string
+		wantCode    int
+		wantActions []string
+	}{
+		{"Gets the audit entries by the user ID as admin successfully", user.ID, AdminEmail, http.StatusOK, []string{models.AuditCreate, models.AuditUpdate}},
+		{"Gets the audit entries by the user email as admin successfully", TestEmail, AdminEmail, http.StatusOK, []string{models.AuditCreate, models.AuditUpdate}},
+		{"Gets the audit entries of the deleted user successfully", deleted.ID, AdminEmail, http.StatusOK, []string{models.AuditCreate, models.AuditDelete}},
+		{"Gets fail due to the user's own audit without permission", user.ID, TestEmail, http.StatusForbidden, nil},
+		{"Gets fail due to unknown user ID", models.NewUserID(), AdminEmail, http.StatusNotFound, nil},
+		{"Gets fail due to unknown user email", "unknown@gmail.com", AdminEmail, http.StatusNotFound, nil},
+		{"Gets fail due to invalid user ID", "abc", AdminEmail, http.StatusUnprocessableEntity, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			respRecorder, router := createRouterAndWriter()
+			server.registerRoutes(router)
+			request, _ := createNewRequest(http.MethodGet, ListURL+"/"+tt.id+"/audit", "", nil)
+			request.Header.Set("Authorization", BearerPrefix+newUserToken(server, tt.email, nil))
+			router.ServeHTTP(respRecorder, request)
+			assert.Equal(t, tt.wantCode, respRecorder.Code)
+			if tt.wantActions == nil {
+				return
+			}
+			var entries []models.AuditEntry
+			require.NoError(t, json.Unmarshal(respRecorder.Body.Bytes(), &entries))
+			actions := []string{}
+			for _, entry := range entries {
+				actions = append(actions, entry.Action)
+			}
+			assert.Equal(t, tt.wantActions, actions)
+			if tt.id != deleted.ID {
+				update := entries[1]
+				assert.Equal(t, admin.ID, update.ActorID)
+				assert.Equal(t, "audit-request", update.RequestID)
+				assert.Equal(t, "10.0.0.1", update.ClientIP)
+				assert.Equal(t, []string{"name"}, keys(update.Changes))
+			}
+		})
+	}
+}
+
+// keys returns the changed fields of the audit entry
+func keys(changes map[string]models.AuditChange) []string {
+	fields := []string{}
+	for field := range changes {
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func TestUserAuditHandler_ClientIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies string
+		wantClientIP   string
+	}{
+		{"Audits the address of the connection despite the spoofed header", "", "10.0.0.1"},
+		{"Audits the forwarded IP of the trusted proxy", "10.0.0.0/8", "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapDB := db.NewTestMapOps("Map DB Audit Client IP Test")
+			require.NoError(t, mapDB.InsertNewUser(context.Background(), *models.NewUser(TestEmail, "bari", "1234")))
+			user, _ := mapDB.IsExistsInUsersTable(context.Background(), TestEmail)
+			config := DefaultConfig()
+			config.JWTSecrets = "secret"
+			config.TrustedProxies = tt.trustedProxies
+			server, err := NewServer(config, mapDB)
+			require.NoError(t, err)
+			server.Logger = logging.New(io.Discard, slog.LevelInfo)
+			respRecorder := httptest.NewRecorder()
+			request, _ := createNewRequest(http.MethodPatch, V1UsersURL+"/"+user.ID, models.MergePatchContentType, strings.NewReader(`{"name": "bari2"}`))
+			request.Header.Set("Authorization", BearerPrefix+newUserToken(server, TestEmail, nil))
+			request.Header.Set("X-Forwarded-For", "203.0.113.7")
+			request.RemoteAddr = "10.0.0.1:4321"
+			server.Router.ServeHTTP(respRecorder, request)
+			require.Equal(t, http.StatusOK, respRecorder.Code)
+			entries, err := mapDB.GetUserAudit(context.Background(), user.ID)
+			require.NoError(t, err)
+			require.Len(t, entries, 2)
+			assert.Equal(t, tt.wantClientIP, entries[1].ClientIP)
+		})
+	}
+}
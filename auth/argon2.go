@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	Argon2idName = "argon2id"
+
+	// The limits of the parameters of the stored hashes, a hash beyond them would make the verification
+	// allocate too much memory (KiB) or take too long
+	maxArgon2idMemory     = 1024 * 1024
+	maxArgon2idIterations = 64
+)
+
+type Argon2idParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follows the OWASP recommendation for argon2id
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+type Argon2idHasher struct {
+	Params Argon2idParams
+}
+
+// NewArgon2idHasher returns a new argon2id hasher
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	return &Argon2idHasher{Params: params}
+}
+
+// Hash returns the password hash in the PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.Params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Params.Iterations, h.Params.Memory, h.Params.Parallelism, h.Params.KeyLength)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", Argon2idName, argon2.Version, h.Params.Memory,
+		h.Params.Iterations, h.Params.Parallelism, base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify compares the password with the encoded argon2id hash
+func (h *Argon2idHasher) Verify(password, encoded string) error {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return err
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrMismatchedPassword
+	}
+	return nil
+}
+
+// CanVerify reports whether the encoded hash is an argon2id hash
+func (h *Argon2idHasher) CanVerify(encoded string) bool {
+	return strings.HasPrefix(encoded, "$"+Argon2idName+"$")
+}
+
+// NeedsRehash reports whether the encoded hash was produced with other parameters
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, _, _, err := decodeArgon2id(encoded)
+	return err != nil || params != h.Params
+}
+
+// decodeArgon2id returns the parameters, salt and key stored in the encoded hash
+func decodeArgon2id(encoded string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+	var version int
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != Argon2idName {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	// argon2.IDKey panics given no iterations or parallelism
+	if params.Iterations < 1 || params.Iterations > maxArgon2idIterations || params.Parallelism < 1 ||
+		params.Memory < 8*uint32(params.Parallelism) || params.Memory > maxArgon2idMemory {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	BcryptName        = "bcrypt"
+	DefaultBcryptCost = 12
+)
+
+type BcryptHasher struct {
+	Cost int
+}
+
+// NewBcryptHasher returns a new bcrypt hasher
+func NewBcryptHasher(cost int) *BcryptHasher {
+	return &BcryptHasher{Cost: cost}
+}
+
+// Hash returns the bcrypt hash of the password ($2a$<cost>$<salt+hash>)
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hash), err
+}
+
+// Verify compares the password with the bcrypt hash
+func (h *BcryptHasher) Verify(password, encoded string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrMismatchedPassword
+	}
+	return err
+}
+
+// CanVerify reports whether the encoded hash is a bcrypt hash
+func (h *BcryptHasher) CanVerify(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// NeedsRehash reports whether the bcrypt hash was produced with another cost
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrMismatchedPassword = errors.New("password doesn't match")
+	ErrUnknownHashFormat  = errors.New("unknown password hash format")
+)
+
+// Hasher hashes passwords into a self-describing encoded string
+// (algorithm and parameters are stored alongside the salt and the hash)
+type Hasher interface {
+	// Hash returns the encoded hash of the password
+	Hash(password string) (string, error)
+	// Verify compares the password with the encoded hash
+	Verify(password, encoded string) error
+	// CanVerify reports whether the encoded hash was produced by this algorithm
+	CanVerify(encoded string) bool
+	// NeedsRehash reports whether the encoded hash uses outdated parameters
+	NeedsRehash(encoded string) bool
+}
+
+// Passwords hashes new passwords with the preferred hasher and verifies
+// stored hashes with any of the known hashers
+type Passwords struct {
+	preferred Hasher
+	hashers   []Hasher
+	dummyOnce sync.Once
+	dummy     string
+}
+
+// NewPasswords returns a new Passwords using preferred for new hashes,
+// the others are used only to verify existing hashes
+func NewPasswords(preferred Hasher, others ...Hasher) *Passwords {
+	return &Passwords{preferred: preferred, hashers: append([]Hasher{preferred}, others...)}
+}
+
+// Hash hashes the password with the preferred hasher
+func (p *Passwords) Hash(password string) (string, error) {
+	return p.preferred.Hash(password)
+}
+
+// Verify checks the password against the encoded hash, needsRehash is true when the
+// password matches but the hash was produced by another algorithm or with old parameters
+func (p *Passwords) Verify(password, encoded string) (needsRehash bool, err error) {
+	for _, hasher := range p.hashers {
+		if !hasher.CanVerify(encoded) {
+			continue
+		}
+		if err = hasher.Verify(password, encoded); err != nil {
+			return false, err
+		}
+		return hasher != p.preferred || hasher.NeedsRehash(encoded), nil
+	}
+	return false, ErrUnknownHashFormat
+}
+
+// VerifyDummy verifies the password against the hash of a random password, so the login of an
+// unknown user takes as long as the one of an existing user and doesn't reveal which emails exist
+func (p *Passwords) VerifyDummy(password string) {
+	p.dummyOnce.Do(func() {
+		random, _ := randomToken(32)
+		p.dummy, _ = p.preferred.Hash(random)
+	})
+	_ = p.preferred.Verify(password, p.dummy)
+}
+
+// NewHasher returns the hasher according to the algorithm name (argon2id or bcrypt)
+func NewHasher(algorithm string) (Hasher, error) {
+	switch algorithm {
+	case "", Argon2idName:
+		return NewArgon2idHasher(DefaultArgon2idParams), nil
+	case BcryptName:
+		return NewBcryptHasher(DefaultBcryptCost), nil
+	}
+	return nil, fmt.Errorf("unsupported password hash algorithm %q", algorithm)
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testArgon2idParams = Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	testArgon2id       = NewArgon2idHasher(testArgon2idParams)
+	testBcrypt         = NewBcryptHasher(4)
+)
+
+func TestHashers(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher Hasher
+	}{
+		{"argon2id hash & verify", testArgon2id},
+		{"bcrypt hash & verify", testBcrypt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := tt.hasher.Hash("1234")
+			assert.NoError(t, err)
+			assert.NotEqual(t, "1234", encoded)
+			assert.True(t, tt.hasher.CanVerify(encoded))
+			assert.False(t, tt.hasher.NeedsRehash(encoded))
+			assert.NoError(t, tt.hasher.Verify("1234", encoded))
+			assert.ErrorIs(t, tt.hasher.Verify("12345", encoded), ErrMismatchedPassword)
+			// The same password is hashed with a different salt each time
+			other, _ := tt.hasher.Hash("1234")
+			assert.NotEqual(t, encoded, other)
+		})
+	}
+}
+
+func TestPasswords_Verify(t *testing.T) {
+	argon2idHash, _ := testArgon2id.Hash("1234")
+	bcryptHash, _ := testBcrypt.Hash("1234")
+	stronger := testArgon2idParams
+	stronger.Iterations = 2
+	tests := []struct {
+		name       string
+		passwords  *Passwords
+		password   string
+		encoded    string
+		wantRehash bool
+		wantErr    error
+	}{
+		{"Verifies the preferred hash", NewPasswords(testArgon2id, testBcrypt), "1234", argon2idHash, false, nil},
+		{"Rehashes a hash of another algorithm", NewPasswords(testArgon2id, testBcrypt), "1234", bcryptHash, true, nil},
+		{"Rehashes when the parameters change", NewPasswords(NewArgon2idHasher(stronger)), "1234", argon2idHash, true, nil},
+		{"Fails due to wrong password", NewPasswords(testArgon2id, testBcrypt), "123", bcryptHash, false, ErrMismatchedPassword},
+		{"Fails due to unknown algorithm", NewPasswords(testArgon2id), "1234", bcryptHash, false, ErrUnknownHashFormat},
+		{"Fails due to plaintext password", NewPasswords(testArgon2id, testBcrypt), "1234", "1234", false, ErrUnknownHashFormat},
+		{"Rehashes a legacy plaintext password", NewPasswords(testArgon2id, NewPlaintextHasher()), "1234", "1234", true, nil},
+		{"Fails due to wrong legacy plaintext password", NewPasswords(testArgon2id, NewPlaintextHasher()), "123", "1234", false, ErrMismatchedPassword},
+		{"Fails due to no iterations", NewPasswords(testArgon2id), "1234", strings.Replace(argon2idHash, "t=1", "t=0", 1), false, ErrUnknownHashFormat},
+		{"Fails due to no parallelism", NewPasswords(testArgon2id), "1234", strings.Replace(argon2idHash, "p=1", "p=0", 1), false, ErrUnknownHashFormat},
+		{"Fails due to too much memory", NewPasswords(testArgon2id), "1234", strings.Replace(argon2idHash, "m=1024", "m=4294967295", 1), false, ErrUnknownHashFormat},
+		{"Fails due to too many iterations", NewPasswords(testArgon2id), "1234", strings.Replace(argon2idHash, "t=1", "t=100000", 1), false, ErrUnknownHashFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			needsRehash, err := tt.passwords.Verify(tt.password, tt.encoded)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.wantRehash, needsRehash)
+		})
+	}
+}
+
+func TestPasswords_VerifyDummy(t *testing.T) {
+	passwords := NewPasswords(testArgon2id)
+	passwords.VerifyDummy("1234")
+	assert.True(t, testArgon2id.CanVerify(passwords.dummy))
+	assert.ErrorIs(t, testArgon2id.Verify("1234", passwords.dummy), ErrMismatchedPassword)
+}
+
+func TestNewHasher(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		wantErr   bool
+	}{
+		{"", false},
+		{Argon2idName, false},
+		{BcryptName, false},
+		{"md5", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			_, err := NewHasher(tt.algorithm)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
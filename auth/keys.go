@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// SigningKey is a key used to sign and verify access tokens
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// NewHMACKey returns a new HS256 signing key
+func NewHMACKey(secret []byte) *SigningKey {
+	sum := sha256.Sum256(secret)
+	return &SigningKey{
+		ID:      base64.RawURLEncoding.EncodeToString(sum[:8]),
+		Method:  jwt.SigningMethodHS256,
+		private: secret,
+		public:  secret,
+	}
+}
+
+// NewRSAKey returns a new RS256 signing key
+func NewRSAKey(key *rsa.PrivateKey) *SigningKey {
+	return &SigningKey{
+		ID:      thumbprint(fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, encodeBigInt(big.NewInt(int64(key.E))), encodeBigInt(key.N))),
+		Method:  jwt.SigningMethodRS256,
+		private: key,
+		public:  &key.PublicKey,
+	}
+}
+
+// NewEd25519Key returns a new EdDSA signing key
+func NewEd25519Key(key ed25519.PrivateKey) *SigningKey {
+	public := key.Public().(ed25519.PublicKey)
+	return &SigningKey{
+		ID:      thumbprint(fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, base64.RawURLEncoding.EncodeToString(public))),
+		Method:  jwt.SigningMethodEdDSA,
+		private: key,
+		public:  public,
+	}
+}
+
+// ParsePrivateKeyPEM returns the RS256 or EdDSA signing key of the PEM encoded private key
+func ParsePrivateKeyPEM(data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return NewRSAKey(key), nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return NewRSAKey(key), nil
+	case ed25519.PrivateKey:
+		return NewEd25519Key(key), nil
+	}
+	return nil, fmt.Errorf("unsupported private key type %T", key)
+}
+
+// JWK returns the public JSON Web Key, symmetric keys are never published
+func (key *SigningKey) JWK() (JWK, bool) {
+	jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encodeBigInt(public.N)
+		jwk.E = encodeBigInt(big.NewInt(int64(public.E)))
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	default:
+		return jwk, false
+	}
+	return jwk, true
+}
+
+// JWK is a public JSON Web Key (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeySet holds the signing keys, the newest key signs new tokens and
+// all the keys verify tokens until they are retired
+type KeySet struct {
+	mu   sync.RWMutex
+	keys []*SigningKey
+}
+
+// NewKeySet returns a new key set, the last key is the current signing key
+func NewKeySet(keys ...*SigningKey) *KeySet {
+	return &KeySet{keys: keys}
+}
+
+// Current returns the key used to sign new tokens
+func (ks *KeySet) Current() (*SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if len(ks.keys) == 0 {
+		return nil, ErrUnknownKey
+	}
+	return ks.keys[len(ks.keys)-1], nil
+}
+
+// Rotate makes the key the current signing key, previous keys keep verifying tokens
+func (ks *KeySet) Rotate(key *SigningKey) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = append(ks.keys, key)
+}
+
+// Retire removes the key, tokens signed by it are no longer valid
+func (ks *KeySet) Retire(id string) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	for i, key := range ks.keys {
+		if key.ID == id {
+			ks.keys = append(ks.keys[:i:i], ks.keys[i+1:]...)
+			return
+		}
+	}
+}
+
+// Lookup returns the key according to its ID
+func (ks *KeySet) Lookup(id string) (*SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, key := range ks.keys {
+		if key.ID == id {
+			return key, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// JWKS returns the public keys of the set
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		if jwk, ok := key.JWK(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	return jwks
+}
+
+// thumbprint returns the JWK thumbprint (RFC 7638) of the canonical JSON
+func thumbprint(canonical string) string {
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// encodeBigInt returns the base64url encoding of the big-endian integer
+func encodeBigInt(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+)
+
+const PlaintextName = "plaintext"
+
+// PlaintextHasher verifies the legacy passwords stored in plaintext before the passwords were hashed,
+// it never hashes new passwords so they are rehashed by the preferred hasher once verified
+type PlaintextHasher struct{}
+
+// NewPlaintextHasher returns a new verifier of the legacy plaintext passwords
+func NewPlaintextHasher() *PlaintextHasher {
+	return &PlaintextHasher{}
+}
+
+// Hash fails, the passwords are never stored in plaintext anymore
+func (h *PlaintextHasher) Hash(password string) (string, error) {
+	return "", errors.New("the passwords cannot be stored in plaintext")
+}
+
+// Verify compares the password with the stored plaintext password in constant time
+func (h *PlaintextHasher) Verify(password, encoded string) error {
+	if subtle.ConstantTimeCompare([]byte(password), []byte(encoded)) != 1 {
+		return ErrMismatchedPassword
+	}
+	return nil
+}
+
+// CanVerify reports whether the stored password is a legacy plaintext password, the encoded
+// hashes start with $ ($argon2id$, $2a$...)
+func (h *PlaintextHasher) CanVerify(encoded string) bool {
+	return encoded != "" && !strings.HasPrefix(encoded, "$")
+}
+
+// NeedsRehash is always true, a plaintext password must be replaced by its hash
+func (h *PlaintextHasher) NeedsRehash(encoded string) bool {
+	return true
+}
@@ -0,0 +1,32 @@
+package auth
+
+import "strings"
+
+// Principal is the authenticated user of the request
+type Principal struct {
+	ID          string
+	Email       string
+	Roles       []string
+	Permissions []string
+}
+
+// HasPermission reports whether one of the principal roles grants the permission
+func (p *Principal) HasPermission(permission string) bool {
+	for _, perm := range p.Permissions {
+		if perm == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccess reports whether the principal may access the user (ID or email), users may
+// always access themselves and other users require the permission
+func (p *Principal) CanAccess(user, permission string) bool {
+	return p.IsSelf(user) || p.HasPermission(permission)
+}
+
+// IsSelf reports whether the user (ID or case-insensitive email) is the principal
+func (p *Principal) IsSelf(user string) bool {
+	return user != "" && (user == p.ID || strings.EqualFold(user, p.Email))
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	DefaultAccessTTL  = 15 * time.Minute
+	DefaultRefreshTTL = 30 * 24 * time.Hour
+	refreshTokenSize  = 32
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims are the claims of the access token, the subject is the user ID
+type Claims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles,omitempty"`
+}
+
+// Principal returns the authenticated user of the claims
+func (c *Claims) Principal() *Principal {
+	return &Principal{ID: c.Subject, Roles: c.Roles}
+}
+
+type TokenIssuer struct {
+	Keys       *KeySet
+	Issuer     string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// NewTokenIssuer returns a new token issuer with the default TTLs
+func NewTokenIssuer(keys *KeySet, issuer string) *TokenIssuer {
+	return &TokenIssuer{Keys: keys, Issuer: issuer, AccessTTL: DefaultAccessTTL, RefreshTTL: DefaultRefreshTTL}
+}
+
+// NewAccessToken returns a new access token for the subject signed with the current key
+func (ti *TokenIssuer) NewAccessToken(subject string, roles []string) (string, time.Time, error) {
+	key, err := ti.Keys.Current()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(ti.AccessTTL)
+	id, err := randomToken(16)
+	if err != nil {
+		return "", expiresAt, err
+	}
+	token := jwt.NewWithClaims(key.Method, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			Issuer:    ti.Issuer,
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Roles: roles,
+	})
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.private)
+	return signed, expiresAt, err
+}
+
+// ParseAccessToken verifies the signature, the algorithm and the expiration of the access token
+func (ti *TokenIssuer) ParseAccessToken(signed string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(signed, claims, func(token *jwt.Token) (interface{}, error) {
+		id, _ := token.Header["kid"].(string)
+		key, err := ti.Keys.Lookup(id)
+		if err != nil {
+			return nil, err
+		}
+		// Rejects tokens signed with another algorithm than the key's one (e.g. "none" or HS256 with a public key)
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, ErrInvalidToken
+		}
+		return key.public, nil
+	}, jwt.WithIssuer(ti.Issuer), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+// NewRefreshToken returns a new opaque refresh token and the hash to persist
+func (ti *TokenIssuer) NewRefreshToken() (token, hash string, expiresAt time.Time, err error) {
+	if token, err = randomToken(refreshTokenSize); err != nil {
+		return "", "", expiresAt, err
+	}
+	return token, HashRefreshToken(token), time.Now().Add(ti.RefreshTTL), nil
+}
+
+// HashRefreshToken returns the hash of the refresh token, only the hash is persisted
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomToken returns a random base64url string of size bytes
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
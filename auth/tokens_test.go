@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenIssuer_AccessToken(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	tests := []struct {
+		name string
+		key  *SigningKey
+	}{
+		{"HS256 access token", NewHMACKey([]byte("secret"))},
+		{"RS256 access token", NewRSAKey(rsaKey)},
+		{"EdDSA access token", NewEd25519Key(edKey)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := NewTokenIssuer(NewKeySet(tt.key), "test")
+			token, expiresAt, err := issuer.NewAccessToken("bari@gmail.com", []string{"admin"})
+			assert.NoError(t, err)
+			assert.WithinDuration(t, time.Now().Add(DefaultAccessTTL), expiresAt, time.Second)
+			claims, err := issuer.ParseAccessToken(token)
+			assert.NoError(t, err)
+			assert.Equal(t, "bari@gmail.com", claims.Subject)
+			assert.Equal(t, []string{"admin"}, claims.Principal().Roles)
+			// A token of another issuer is rejected
+			_, err = NewTokenIssuer(NewKeySet(tt.key), "other").ParseAccessToken(token)
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+}
+
+func TestTokenIssuer_ParseAccessTokenFailures(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	key := NewRSAKey(rsaKey)
+	issuer := NewTokenIssuer(NewKeySet(key), "test")
+
+	expired := NewTokenIssuer(NewKeySet(key), "test")
+	expired.AccessTTL = -time.Minute
+	expiredToken, _, _ := expired.NewAccessToken("bari@gmail.com", nil)
+
+	// Signs an HS256 token with the RSA key ID
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Issuer: "test", Subject: "bari@gmail.com", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}})
+	confused.Header["kid"] = key.ID
+	confusedToken, _ := confused.SignedString([]byte("secret"))
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"Fails due to malformed token", "abc"},
+		{"Fails due to expired token", expiredToken},
+		{"Fails due to algorithm confusion", confusedToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := issuer.ParseAccessToken(tt.token)
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+}
+
+func TestKeySet_Rotate(t *testing.T) {
+	oldKey := NewHMACKey([]byte("old"))
+	newKey := NewHMACKey([]byte("new"))
+	keys := NewKeySet(oldKey)
+	issuer := NewTokenIssuer(keys, "test")
+	oldToken, _, _ := issuer.NewAccessToken("bari@gmail.com", nil)
+
+	keys.Rotate(newKey)
+	current, _ := keys.Current()
+	assert.Equal(t, newKey.ID, current.ID)
+	// Tokens signed with the previous key are still valid until it's retired
+	_, err := issuer.ParseAccessToken(oldToken)
+	assert.NoError(t, err)
+	keys.Retire(oldKey.ID)
+	_, err = issuer.ParseAccessToken(oldToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestKeySet_JWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	keys := NewKeySet(NewHMACKey([]byte("secret")), NewRSAKey(rsaKey), NewEd25519Key(edKey))
+
+	// The symmetric key is never published
+	jwks := keys.JWKS()
+	assert.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "RSA", jwks.Keys[0].KeyType)
+	assert.Equal(t, "RS256", jwks.Keys[0].Algorithm)
+	assert.Equal(t, "OKP", jwks.Keys[1].KeyType)
+	assert.Equal(t, "EdDSA", jwks.Keys[1].Algorithm)
+}
+
+func TestTokenIssuer_NewRefreshToken(t *testing.T) {
+	issuer := NewTokenIssuer(NewKeySet(), "test")
+	token, hash, expiresAt, err := issuer.NewRefreshToken()
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, hash)
+	assert.Equal(t, hash, HashRefreshToken(token))
+	assert.WithinDuration(t, time.Now().Add(DefaultRefreshTTL), expiresAt, time.Second)
+}
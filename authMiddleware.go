@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"gin_CRUD_server/auth"
+	"gin_CRUD_server/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	PrincipalKey = "principal"
+	BearerPrefix = "Bearer "
+)
+
+// RequireAuth validates the bearer access token and attaches the principal to the context,
+// the roles & permissions are loaded from the DB so that revoking a role takes effect immediately
+func (s *Server) RequireAuth(ctx *gin.Context) {
+	header := ctx.GetHeader("Authorization")
+	if !strings.HasPrefix(header, BearerPrefix) {
+		abortUnauthorized(ctx, "", "missing bearer access token")
+		return
+	}
+	claims, err := s.Tokens.ParseAccessToken(strings.TrimPrefix(header, BearerPrefix))
+	if err != nil {
+		abortUnauthorized(ctx, "invalid_token", "invalid or expired access token")
+		return
+	}
+	principal := claims.Principal()
+	user, err := s.DB.GetUserByID(ctx.Request.Context(), principal.ID)
+	if errors.Is(err, models.ErrUserNotFound) {
+		abortUnauthorized(ctx, "invalid_token", "the user of the access token doesn't exist")
+		return
+	} else if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	principal.Email = user.Email
+	principal.Roles = user.Roles
+	if principal.Permissions, err = s.DB.GetRolesPermissions(ctx.Request.Context(), principal.Roles); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	ctx.Set(PrincipalKey, principal)
+	// The changes of the request are audited as changes of the principal
+	info := models.AuditInfoFrom(ctx.Request.Context())
+	info.ActorID = principal.ID
+	ctx.Request = ctx.Request.WithContext(models.WithAuditInfo(ctx.Request.Context(), info))
+	ctx.Next()
+}
+
+// RequirePermission allows only principals with the permission to continue
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if principal := getPrincipal(ctx); principal == nil || !principal.HasPermission(permission) {
+			abortWithProblem(ctx, models.CodeForbidden, "the %s permission is required", permission)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// RequireSelfOrPermission allows users to access themselves and principals with the permission
+// to access anyone, the target ID or email is extracted from the request by target
+func RequireSelfOrPermission(permission string, target func(*gin.Context) string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if principal := getPrincipal(ctx); principal == nil || !principal.CanAccess(target(ctx), permission) {
+			abortWithProblem(ctx, models.CodeForbidden, "the %s permission is required to access other users", permission)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// getPrincipal returns the authenticated user of the request or nil
+func getPrincipal(ctx *gin.Context) *auth.Principal {
+	if val, ok := ctx.Get(PrincipalKey); ok {
+		if principal, ok := val.(*auth.Principal); ok {
+			return principal
+		}
+	}
+	return nil
+}
+
+// emailFromForm returns the target email from the form-data
+func emailFromForm(ctx *gin.Context) string {
+	return ctx.PostForm(FieldName)
+}
+
+// emailFromJSON returns the target email from the JSON body, the body is restored for the handler
+func emailFromJSON(ctx *gin.Context) string {
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		return ""
+	}
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+	target := struct {
+		Email string `json:"email"`
+	}{}
+	json.Unmarshal(body, &target)
+	return target.Email
+}
+
+// abortUnauthorized aborts the request with 401 and the bearer challenge (RFC 6750)
+func abortUnauthorized(ctx *gin.Context, code, msg string) {
+	challenge := `Bearer realm="` + TokenIssuer + `"`
+	if code != "" {
+		challenge += `, error="` + code + `"`
+	}
+	ctx.Header("WWW-Authenticate", challenge)
+	abortWithProblem(ctx, models.CodeUnauthorized, "%s", msg)
+}
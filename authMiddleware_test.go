@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"gin_CRUD_server/auth"
+	"gin_CRUD_server/db"
+	"gin_CRUD_server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const AdminEmail = "admin@gmail.com"
+
+func TestAuthMiddleware(t *testing.T) {
+	server := newTestServer(t, MapDB)
+	server.Admins = newAdmins(AdminEmail)
+	otherEmail := "other@gmail.com"
+	for _, email := range []string{TestEmail, otherEmail, AdminEmail} {
+		server.DB.InsertNewUser(context.Background(), *models.NewUser(email, "bari", "1234"))
+	}
+	require.NoError(t, server.GrantAdmins(context.Background()))
+	defer server.DB.DeleteUser(context.Background(), otherEmail)
+	defer server.DB.DeleteUser(context.Background(), AdminEmail)
+
+	userToken := newUserToken(server, TestEmail, nil)
+	adminToken := newUserToken(server, AdminEmail, nil)
+	// The roles of the token are ignored, the roles are loaded from the DB
+	fakeAdminToken := newUserToken(server, TestEmail, []string{models.RoleAdmin})
+	unknownToken, _, _ := server.Tokens.NewAccessToken(models.NewUserID(), nil)
+	otherIssuer := auth.NewTokenIssuer(auth.NewKeySet(auth.NewHMACKey([]byte("other"))), TokenIssuer)
+	admin, _ := server.DB.IsExistsInUsersTable(context.Background(), AdminEmail)
+	forgedToken, _, _ := otherIssuer.NewAccessToken(admin.ID, nil)
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		token    string
+		email    string
+		user     *models.User
+		wantCode int
+	}{
+		{"Gets fail due to missing token", http.MethodGet, URL, "", TestEmail, nil, http.StatusUnauthorized},
+		{"Gets fail due to malformed token", http.MethodGet, URL, "abc", TestEmail, nil, http.StatusUnauthorized},
+		{"Gets fail due to token signed with unknown key", http.MethodGet, URL, forgedToken, TestEmail, nil, http.StatusUnauthorized},
+		{"Gets fail due to token of unknown user", http.MethodGet, URL, unknownToken, "unknown@gmail.com", nil, http.StatusUnauthorized},
+		{"Gets the user itself successfully", http.MethodGet, URL, userToken, TestEmail, nil, http.StatusOK},
+		{"Gets fail due to another user", http.MethodGet, URL, userToken, otherEmail, nil, http.StatusForbidden},
+		{"Gets another user as admin successfully", http.MethodGet, URL, adminToken, otherEmail, nil, http.StatusOK},
+		{"Updates fail due to another user", http.MethodPost, URL, userToken, "", models.NewUser(otherEmail, "x", "1"), http.StatusForbidden},
+		{"Updates the user itself successfully", http.MethodPost, URL, userToken, "", models.NewUser(TestEmail, "bari2", "1"), http.StatusOK},
+		{"Lists fail due to member user", http.MethodGet, ListURL, userToken, "", nil, http.StatusForbidden},
+		{"Lists fail due to roles claim of the token", http.MethodGet, ListURL, fakeAdminToken, "", nil, http.StatusForbidden},
+		{"Lists users as admin successfully", http.MethodGet, ListURL, adminToken, "", nil, http.StatusOK},
+		{"Deletes fail due to another user", http.MethodDelete, URL, userToken, otherEmail, nil, http.StatusForbidden},
+		{"Deletes the user itself successfully", http.MethodDelete, URL, userToken, TestEmail, nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			respRecorder, router := createRouterAndWriter()
+			server.registerRoutes(router)
+			var request *http.Request
+			var err error
+			if tt.user != nil {
+				request, err = newBindJSONRequest(tt.user, tt.url, tt.method)
+			} else {
+				request, err = newFormDataRequest(tt.email, tt.url, tt.method)
+			}
+			if err != nil {
+				t.Errorf("create request Error: %v\n", err)
+			}
+			if tt.token != "" {
+				request.Header.Set("Authorization", BearerPrefix+tt.token)
+			}
+			router.ServeHTTP(respRecorder, request)
+			assert.Equal(t, tt.wantCode, respRecorder.Code)
+			if tt.wantCode == http.StatusUnauthorized {
+				assert.Contains(t, respRecorder.Header().Get("WWW-Authenticate"), "Bearer")
+			}
+		})
+	}
+}
+
+func TestRoleHandlers(t *testing.T) {
+	server := newTestServer(t, MapDB)
+	server.Admins = newAdmins(AdminEmail)
+	for _, email := range []string{TestEmail, AdminEmail} {
+		server.DB.InsertNewUser(context.Background(), *models.NewUser(email, "bari", "1234"))
+		defer server.DB.DeleteUser(context.Background(), email)
+	}
+	require.NoError(t, server.GrantAdmins(context.Background()))
+	userToken := newUserToken(server, TestEmail, nil)
+	adminToken := newUserToken(server, AdminEmail, nil)
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		token    string
+		body     interface{}
+		wantCode int
+	}{
+		{"Grants fail due to missing permission", http.MethodPut, RolesURL, userToken, roleRequest{TestEmail, models.RoleAdmin}, http.StatusForbidden},
+		{"Grants fail due to unknown role", http.MethodPut, RolesURL, adminToken, roleRequest{TestEmail, "root"}, http.StatusUnprocessableEntity},
+		{"Grants fail due to unknown user", http.MethodPut, RolesURL, adminToken, roleRequest{"a@gmail.com", models.RoleSupport}, http.StatusNotFound},
+		{"Lists fail before the support role is granted", http.MethodGet, ListURL, userToken, nil, http.StatusForbidden},
+		{"Grants the support role successfully", http.MethodPut, RolesURL, adminToken, roleRequest{TestEmail, models.RoleSupport}, http.StatusOK},
+		{"Lists users as support successfully", http.MethodGet, ListURL, userToken, nil, http.StatusOK},
+		{"Grants fail due to support without the roles permission", http.MethodPut, RolesURL, userToken, roleRequest{TestEmail, models.RoleAdmin}, http.StatusForbidden},
+		{"Revokes the support role successfully", http.MethodDelete, RolesURL, adminToken, roleRequest{TestEmail, models.RoleSupport}, http.StatusOK},
+		{"Revokes fail due to role the user doesn't have", http.MethodDelete, RolesURL, adminToken, roleRequest{TestEmail, models.RoleSupport}, http.StatusNotFound},
+		{"Lists fail after the support role is revoked", http.MethodGet, ListURL, userToken, nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			respRecorder, router := createRouterAndWriter()
+			server.registerRoutes(router)
+			buf, _ := json.Marshal(tt.body)
+			request, err := createNewRequest(tt.method, tt.url, "application/json", bytes.NewBuffer(buf))
+			if err != nil {
+				t.Errorf(err.Error())
+			}
+			request.Header.Set("Authorization", BearerPrefix+tt.token)
+			router.ServeHTTP(respRecorder, request)
+			assert.Equal(t, tt.wantCode, respRecorder.Code)
+		})
+	}
+	user, _ := server.DB.IsExistsInUsersTable(context.Background(), TestEmail)
+	assert.Equal(t, []string{models.RoleMember}, user.Roles)
+}
+
+// newUserToken returns an access token of the user according to its email
+func newUserToken(server *Server, email string, roles []string) string {
+	user, _ := server.DB.IsExistsInUsersTable(context.Background(), email)
+	token, _, _ := server.Tokens.NewAccessToken(user.ID, roles)
+	return token
+}
+
+func TestBootstrapAdmins(t *testing.T) {
+	server := newTestServer(t, db.NewTestMapOps("Map DB Bootstrap Admins Test"))
+	server.Admins = newAdmins(AdminEmail + ",signup@gmail.com,renamed@gmail.com")
+	hash, _ := server.Passwords.Hash("1234")
+	user := models.NewUser(TestEmail, "bari", hash)
+	require.NoError(t, server.DB.InsertNewUser(context.Background(), *user))
+	// The admins don't exist yet, only the existing users are granted the admin role at startup
+	require.NoError(t, server.GrantAdmins(context.Background()))
+	userToken := newUserToken(server, TestEmail, nil)
+	// The member gets the email of an admin despite the handler refusing it
+	require.NoError(t, server.DB.ChangeEmail(context.Background(), user.ID, "renamed@gmail.com", 0))
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		body     interface{}
+		wantCode int
+	}{
+		{"Changes the email fail due to the email of an admin", http.MethodPut, V1UsersURL + "/" + user.ID + "/email", emailChange{AdminEmail, "1234"}, http.StatusUnprocessableEntity},
+		{"Lists fail due to the member with the email of an admin", http.MethodGet, ListURL, nil, http.StatusForbidden},
+		{"Grants fail due to the member with the email of an admin", http.MethodPut, RolesURL, roleRequest{AdminEmail, models.RoleAdmin}, http.StatusForbidden},
+		{"Signs up with the email of an admin", http.MethodPost, V1UsersURL, models.NewUser("signup@gmail.com", "bari", "1234"), http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			respRecorder, router := createRouterAndWriter()
+			server.registerRoutes(router)
+			buf, _ := json.Marshal(tt.body)
+			request, _ := createNewRequest(tt.method, tt.url, "application/json", bytes.NewBuffer(buf))
+			request.Header.Set("Authorization", BearerPrefix+userToken)
+			router.ServeHTTP(respRecorder, request)
+			assert.Equal(t, tt.wantCode, respRecorder.Code)
+		})
+	}
+	for _, email := range []string{"renamed@gmail.com", "signup@gmail.com"} {
+		member, err := server.DB.IsExistsInUsersTable(context.Background(), email)
+		require.NoError(t, err)
+		assert.Equal(t, []string{models.RoleMember}, member.Roles)
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gin_CRUD_server/auth"
+	"gin_CRUD_server/db"
+	"gin_CRUD_server/logging"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ConfigFileEnv = "CONFIG_FILE"
+	// SecretFileSuffix is appended to the key, environment variable or flag of a secret to read it from a file
+	SecretFileSuffix = "_file"
+	Redacted         = logging.Redacted
+)
+
+// Config is the configuration of the server
+type Config struct {
+	Port     string
+	CertFile string
+	KeyFile  string
+	DB       db.Config
+
+	// PasswordHashAlgorithm is the algorithm of the new password hashes (argon2id or bcrypt)
+	PasswordHashAlgorithm string
+	// JWTSigningMethod is HS256, RS256 or EdDSA
+	JWTSigningMethod string
+	// JWTSecrets are the comma-separated HS256 secrets, the last one signs new tokens
+	JWTSecrets string
+	// JWTPrivateKeyFiles are the comma-separated RS256/EdDSA PEM private key files, the last one signs new tokens
+	JWTPrivateKeyFiles string
+	// AdminEmails are the comma-separated emails of the existing users granted the admin role at startup
+	AdminEmails string
+	// ReadinessTimeout is the deadline of the checks of the readiness route
+	ReadinessTimeout time.Duration
+	// ShutdownDelay is the time the server keeps serving when it isn't ready anymore before shutting down,
+	// DrainTimeout is the maximum wait for the in-flight requests before their connections are closed
+	ShutdownDelay time.Duration
+	DrainTimeout  time.Duration
+	// TracingExporter exports the spans to the OTLP collector of the TracingEndpoint URL, to stdout
+	// or nowhere (otlp, stdout or none)
+	TracingExporter string
+	TracingEndpoint string
+	// LogLevel is the minimum level of the logs (debug, info, warn or error)
+	LogLevel string
+	// TrustedProxies are the comma-separated IPs and CIDRs of the proxies whose X-Forwarded-For header
+	// sets the client IP, the client IP is the address of the connection when there is none
+	TrustedProxies string
+}
+
+// configField is a setting of the config, it is set by the key of the config file, the environment
+// variable or the command-line flag (the key with dashes). Secrets are also read from the file named
+// by the key, variable or flag with the SecretFileSuffix, like the Docker secrets
+type configField struct {
+	key    string
+	env    string
+	usage  string
+	secret bool
+	field  func(config *Config) interface{}
+}
+
+var configFields = []configField{
+	{"port", "SERVER_PORT", "the address the server listens on", false, func(c *Config) interface{} { return &c.Port }},
+	{"cert_file", "TLS_CERT_FILE", "the TLS certificate file", false, func(c *Config) interface{} { return &c.CertFile }},
+	{"key_file", "TLS_KEY_FILE", "the TLS private key file", false, func(c *Config) interface{} { return &c.KeyFile }},
+	{"db.host", "POSTGRES_HOST", "the DB host", false, func(c *Config) interface{} { return &c.DB.Hostname }},
+	{"db.port", "POSTGRES_PORT", "the DB port", false, func(c *Config) interface{} { return &c.DB.Port }},
+	{"db.user", "POSTGRES_USER", "the DB user", false, func(c *Config) interface{} { return &c.DB.User }},
+	{"db.password", "POSTGRES_PASSWORD", "the DB password", true, func(c *Config) interface{} { return &c.DB.Password }},
+	{"db.name", "POSTGRES_DB", "the DB name", false, func(c *Config) interface{} { return &c.DB.DBName }},
+	{"db.ssl", "POSTGRES_SSL", "the DB SSL mode (disable, allow, prefer, require, verify-ca or verify-full)", false, func(c *Config) interface{} { return &c.DB.SSL }},
+	{"db.query_timeout", "DB_QUERY_TIMEOUT", "the timeout of each DB operation, 0 for no timeout", false, func(c *Config) interface{} { return &c.DB.QueryTimeout }},
+	{"db.connect_timeout", "DB_CONNECT_TIMEOUT", "the maximum wait for the DB at startup, 0 for a single attempt", false, func(c *Config) interface{} { return &c.DB.ConnectTimeout }},
+	{"db.connect_backoff", "DB_CONNECT_BACKOFF", "the initial delay between the DB connection attempts, doubled after each failure", false, func(c *Config) interface{} { return &c.DB.ConnectBackoff }},
+	{"db.connect_max_backoff", "DB_CONNECT_MAX_BACKOFF", "the maximum delay between the DB connection attempts", false, func(c *Config) interface{} { return &c.DB.ConnectMaxBackoff }},
+	{"db.max_open_conns", "DB_MAX_OPEN_CONNS", "the maximum number of open DB connections, 0 for unlimited", false, func(c *Config) interface{} { return &c.DB.MaxOpenConns }},
+	{"db.max_idle_conns", "DB_MAX_IDLE_CONNS", "the maximum number of idle DB connections, 0 to retain none", false, func(c *Config) interface{} { return &c.DB.MaxIdleConns }},
+	{"db.conn_max_lifetime", "DB_CONN_MAX_LIFETIME", "the maximum lifetime of a DB connection, 0 to reuse it forever", false, func(c *Config) interface{} { return &c.DB.ConnMaxLifetime }},
+	{"db.conn_max_idle_time", "DB_CONN_MAX_IDLE_TIME", "the maximum idle time of a DB connection, 0 to keep it forever", false, func(c *Config) interface{} { return &c.DB.ConnMaxIdleTime }},
+	{"password_hash_algorithm", "PASSWORD_HASH_ALGORITHM", "the algorithm of the new password hashes (argon2id or bcrypt)", false, func(c *Config) interface{} { return &c.PasswordHashAlgorithm }},
+	{"jwt_signing_method", "JWT_SIGNING_METHOD", "the signing method of the access tokens (HS256, RS256 or EdDSA)", false, func(c *Config) interface{} { return &c.JWTSigningMethod }},
+	{"jwt_secrets", "JWT_SECRET", "the comma-separated HS256 secrets, the last one signs new tokens", true, func(c *Config) interface{} { return &c.JWTSecrets }},
+	{"jwt_private_key_files", "JWT_PRIVATE_KEY_FILES", "the comma-separated RS256/EdDSA PEM private key files, the last one signs new tokens", false, func(c *Config) interface{} { return &c.JWTPrivateKeyFiles }},
+	{"admin_emails", "ADMIN_EMAILS", "the comma-separated emails of the existing users granted the admin role at startup", false, func(c *Config) interface{} { return &c.AdminEmails }},
+	{"readiness_timeout", "READINESS_TIMEOUT", "the deadline of the checks of the readiness route", false, func(c *Config) interface{} { return &c.ReadinessTimeout }},
+	{"shutdown_delay", "SHUTDOWN_DELAY", "the time the server keeps serving when it isn't ready anymore before shutting down", false, func(c *Config) interface{} { return &c.ShutdownDelay }},
+	{"drain_timeout", "DRAIN_TIMEOUT", "the maximum wait for the in-flight requests at shutdown", false, func(c *Config) interface{} { return &c.DrainTimeout }},
+	{"tracing.exporter", "OTEL_TRACES_EXPORTER", "the exporter of the spans (otlp, stdout or none)", false, func(c *Config) interface{} { return &c.TracingExporter }},
+	{"tracing.endpoint", "OTEL_EXPORTER_OTLP_ENDPOINT", "the URL of the OTLP/HTTP collector", false, func(c *Config) interface{} { return &c.TracingEndpoint }},
+	{"log_level", "LOG_LEVEL", "the minimum level of the logs (debug, info, warn or error)", false, func(c *Config) interface{} { return &c.LogLevel }},
+	{"trusted_proxies", "TRUSTED_PROXIES", "the comma-separated IPs and CIDRs of the trusted proxies", false, func(c *Config) interface{} { return &c.TrustedProxies }},
+}
+
+// DefaultConfig returns the config used when no file, environment variable or flag sets a setting
+func DefaultConfig() Config {
+	return Config{
+		Port:     Port,
+		CertFile: CertFile,
+		KeyFile:  KeyFile,
+		DB: db.Config{
+			Hostname:          Host,
+			Port:              DBPort,
+			SSL:               "require",
+			QueryTimeout:      DefaultQueryTimeout,
+			ConnectTimeout:    DefaultConnectTimeout,
+			ConnectBackoff:    DefaultConnectBackoff,
+			ConnectMaxBackoff: DefaultConnectMaxBackoff,
+			MaxIdleConns:      DefaultMaxIdleConns,
+			ConnMaxLifetime:   DefaultConnMaxLifetime,
+		},
+		PasswordHashAlgorithm: auth.Argon2idName,
+		JWTSigningMethod:      "HS256",
+		ReadinessTimeout:      DefaultReadinessTimeout,
+		ShutdownDelay:         DefaultShutdownDelay,
+		DrainTimeout:          DefaultDrainTimeout,
+		TracingExporter:       DefaultTracingExporter,
+		TracingEndpoint:       DefaultTracingEndpoint,
+		LogLevel:              DefaultLogLevel,
+	}
+}
+
+// LoadConfig returns the config from the defaults, the config file (YAML or TOML), the environment
+// variables and the command-line flags, in increasing order of precedence. The config file is set by
+// the --config flag or the CONFIG_FILE environment variable, printConfig is set by the --print-config flag
+func LoadConfig(args []string, lookupEnv func(string) (string, bool)) (config Config, printConfig bool, err error) {
+	config = DefaultConfig()
+	flags := flag.NewFlagSet("gin_CRUD_server", flag.ContinueOnError)
+	configFile := flags.String("config", "", "the YAML or TOML config file (CONFIG_FILE)")
+	flags.BoolVar(&printConfig, "print-config", false, "prints the config with the secrets redacted")
+	for _, field := range configFields {
+		flags.String(field.flagName(), "", fmt.Sprintf("%s (%s)", field.usage, field.env))
+		if field.secret {
+			flags.String(field.flagName()+"-file", "", fmt.Sprintf("the file of %s (%s%s)", field.usage, field.env, strings.ToUpper(SecretFileSuffix)))
+		}
+	}
+	if err = flags.Parse(args); err != nil {
+		return config, printConfig, err
+	}
+	if *configFile == "" {
+		*configFile, _ = lookupEnv(ConfigFileEnv)
+	}
+	if *configFile != "" {
+		if err = config.loadFile(*configFile); err != nil {
+			return config, printConfig, err
+		}
+	}
+	for _, field := range configFields {
+		if value, ok := lookupEnv(field.env); ok {
+			err = field.set(&config, value)
+		} else if file, ok := lookupEnv(field.env + strings.ToUpper(SecretFileSuffix)); ok && field.secret {
+			err = field.setFromFile(&config, file)
+		}
+		if err != nil {
+			return config, printConfig, fmt.Errorf("Invalid %s: %s\n", field.env, err)
+		}
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if err != nil || f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+		if err = config.setSetting(f.Name, f.Value.String(), configField.flagName, "-file"); err != nil {
+			err = fmt.Errorf("Invalid --%s: %s\n", f.Name, err)
+		}
+	})
+	return config, printConfig, err
+}
+
+// loadFile sets the settings of the YAML or TOML config file according to its extension,
+// the sections of the keys are nested tables and the lists are comma-separated settings
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Cannot read the config file %q: %s\n", path, err)
+	}
+	values := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return fmt.Errorf("Unsupported config file %q, please use a .yaml, .yml or .toml file\n", path)
+	}
+	if err != nil {
+		return fmt.Errorf("Cannot parse the config file %q: %s\n", path, err)
+	}
+	settings := map[string]string{}
+	flattenSettings("", values, settings)
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err = c.setSetting(key, settings[key], configField.fileKey, SecretFileSuffix); err != nil {
+			return fmt.Errorf("Invalid %s in the config file %q: %s\n", key, path, err)
+		}
+	}
+	return nil
+}
+
+// setSetting sets the setting named by the key or flag according to name, a secret is read
+// from the file when its name has the file suffix
+func (c *Config) setSetting(setting, value string, name func(configField) string, fileSuffix string) error {
+	for _, field := range configFields {
+		if setting == name(field) {
+			return field.set(c, value)
+		}
+		if field.secret && setting == name(field)+fileSuffix {
+			return field.setFromFile(c, value)
+		}
+	}
+	return fmt.Errorf("unknown setting")
+}
+
+// flattenSettings flattens the nested tables to the dotted keys of their settings
+func flattenSettings(prefix string, values map[string]interface{}, settings map[string]string) {
+	for key, value := range values {
+		switch value := value.(type) {
+		case map[string]interface{}:
+			flattenSettings(prefix+key+".", value, settings)
+		case []interface{}:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			settings[prefix+key] = strings.Join(items, ",")
+		case nil:
+			settings[prefix+key] = ""
+		default:
+			settings[prefix+key] = fmt.Sprint(value)
+		}
+	}
+}
+
+// fileKey returns the key of the field in the config file
+func (f configField) fileKey() string {
+	return f.key
+}
+
+// flagName returns the command-line flag of the field
+func (f configField) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(f.key)
+}
+
+// set parses the value of the field
+func (f configField) set(config *Config, value string) error {
+	switch field := f.field(config).(type) {
+	case *string:
+		*field = value
+	case *int:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q isn't a number", value)
+		}
+		*field = number
+	case *time.Duration:
+		duration, err := parseDuration(value, *field)
+		if err != nil {
+			return err
+		}
+		*field = duration
+	}
+	return nil
+}
+
+// setFromFile sets the secret from the content of the file, without its trailing newline
+func (f configField) setFromFile(config *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read the secret file: %s", err)
+	}
+	return f.set(config, strings.TrimRight(string(data), "\r\n"))
+}
+
+// get returns the value of the field, a non-empty secret is redacted
+func (f configField) get(config *Config) interface{} {
+	switch field := f.field(config).(type) {
+	case *string:
+		if f.secret && *field != "" {
+			return Redacted
+		}
+		return *field
+	case *int:
+		return *field
+	case *time.Duration:
+		return field.String()
+	}
+	return nil
+}
+
+// Validate returns an error describing all the invalid settings of the config
+func (c Config) Validate() error {
+	var problems []string
+	if _, _, err := net.SplitHostPort(c.Port); err != nil {
+		problems = append(problems, fmt.Sprintf("port %q must be an address like :3000", c.Port))
+	}
+	for name, value := range map[string]string{"cert_file": c.CertFile, "key_file": c.KeyFile, "db.host": c.DB.Hostname, "db.user": c.DB.User, "db.name": c.DB.DBName} {
+		if value == "" {
+			problems = append(problems, name+" is required")
+		}
+	}
+	if port, err := strconv.Atoi(c.DB.Port); err != nil || port < 1 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("db.port %q must be a number between 1 and 65535", c.DB.Port))
+	}
+	switch c.DB.SSL {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		problems = append(problems, fmt.Sprintf("db.ssl %q must be disable, allow, prefer, require, verify-ca or verify-full", c.DB.SSL))
+	}
+	if c.DB.QueryTimeout < 0 {
+		problems = append(problems, "db.query_timeout must not be negative")
+	}
+	if c.DB.MaxOpenConns < 0 || c.DB.MaxIdleConns < 0 {
+		problems = append(problems, "db.max_open_conns and db.max_idle_conns must not be negative")
+	}
+	if c.DB.ConnMaxLifetime < 0 || c.DB.ConnMaxIdleTime < 0 {
+		problems = append(problems, "db.conn_max_lifetime and db.conn_max_idle_time must not be negative")
+	}
+	if c.DB.ConnectTimeout < 0 {
+		problems = append(problems, "db.connect_timeout must not be negative")
+	}
+	if c.DB.ConnectBackoff <= 0 || c.DB.ConnectMaxBackoff < c.DB.ConnectBackoff {
+		problems = append(problems, "db.connect_backoff must be positive and at most db.connect_max_backoff")
+	}
+	if c.ReadinessTimeout <= 0 {
+		problems = append(problems, "readiness_timeout must be positive")
+	}
+	if c.ShutdownDelay < 0 || c.DrainTimeout < 0 {
+		problems = append(problems, "shutdown_delay and drain_timeout must not be negative")
+	}
+	if _, err := auth.NewHasher(c.PasswordHashAlgorithm); err != nil {
+		problems = append(problems, fmt.Sprintf("password_hash_algorithm %q must be argon2id or bcrypt", c.PasswordHashAlgorithm))
+	}
+	switch c.JWTSigningMethod {
+	case "", "HS256":
+	case "RS256", "EdDSA":
+		if c.JWTPrivateKeyFiles == "" {
+			problems = append(problems, "jwt_private_key_files is required by the "+c.JWTSigningMethod+" signing method")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("jwt_signing_method %q must be HS256, RS256 or EdDSA", c.JWTSigningMethod))
+	}
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		problems = append(problems, fmt.Sprintf("log_level %q must be debug, info, warn or error", c.LogLevel))
+	}
+	switch c.TracingExporter {
+	case TracingNone, TracingStdout:
+	case TracingOTLP:
+		if _, err := otlpOptions(c.TracingEndpoint); err != nil {
+			problems = append(problems, fmt.Sprintf("tracing.endpoint %q must be a URL like %s", c.TracingEndpoint, DefaultTracingEndpoint))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("tracing.exporter %q must be otlp, stdout or none", c.TracingExporter))
+	}
+	for _, email := range strings.Split(c.AdminEmails, ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			if _, err := mail.ParseAddress(email); err != nil {
+				problems = append(problems, fmt.Sprintf("admin_emails %q is an invalid email", email))
+			}
+		}
+	}
+	for _, proxy := range trustedProxies(c.TrustedProxies) {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			problems = append(problems, fmt.Sprintf("trusted_proxies %q is an invalid IP or CIDR", proxy))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("Invalid config: %s\n", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// PrintRedacted prints the config as YAML with its secrets redacted
+func (c Config) PrintRedacted(w io.Writer) error {
+	values := map[string]interface{}{}
+	for _, field := range configFields {
+		section, key := values, field.key
+		if i := strings.Index(key, "."); i >= 0 {
+			if _, ok := values[key[:i]]; !ok {
+				values[key[:i]] = map[string]interface{}{}
+			}
+			section, key = values[key[:i]].(map[string]interface{}), key[i+1:]
+		}
+		section[key] = field.get(&c)
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	defer encoder.Close()
+	return encoder.Encode(values)
+}
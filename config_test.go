@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	yamlConfig = `
+port: ":4000"
+db:
+  host: yaml-host
+  user: yaml_user
+  name: users_db
+  query_timeout: 2s
+admin_emails:
+  - bari@gmail.com
+  - admin@gmail.com
+`
+	tomlConfig = `
+port = ":5000"
+[db]
+host = "toml-host"
+port = 6543
+password_file = "%s"
+`
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+		return path
+	}
+	secretFile := writeFile("db_password", "file_pass\n")
+	yamlFile := writeFile("config.yaml", yamlConfig)
+	tomlFile := writeFile("config.toml", fmt.Sprintf(tomlConfig, secretFile))
+	unknownFile := writeFile("unknown.yml", "db:\n  hostname: x\n")
+	jsonFile := writeFile("config.json", "{}")
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		check   func(t *testing.T, config Config)
+		wantErr bool
+	}{
+		{"Loads the defaults successfully", nil, nil, func(t *testing.T, config Config) {
+			assert.Equal(t, DefaultConfig(), config)
+		}, false},
+		{"Loads the YAML file successfully", []string{"--config", yamlFile}, nil, func(t *testing.T, config Config) {
+			assert.Equal(t, ":4000", config.Port)
+			assert.Equal(t, "yaml-host", config.DB.Hostname)
+			assert.Equal(t, DBPort, config.DB.Port)
+			assert.Equal(t, 2*time.Second, config.DB.QueryTimeout)
+			assert.Equal(t, "bari@gmail.com,admin@gmail.com", config.AdminEmails)
+		}, false},
+		{"Loads the TOML file of CONFIG_FILE with a secret file successfully", nil, map[string]string{ConfigFileEnv: tomlFile}, func(t *testing.T, config Config) {
+			assert.Equal(t, ":5000", config.Port)
+			assert.Equal(t, "toml-host", config.DB.Hostname)
+			assert.Equal(t, "6543", config.DB.Port)
+			assert.Equal(t, "file_pass", config.DB.Password)
+		}, false},
+		{"Loads the environment variables over the file successfully", []string{"--config", yamlFile}, map[string]string{"POSTGRES_HOST": "env-host", "POSTGRES_PASSWORD_FILE": secretFile, "DB_QUERY_TIMEOUT": "0", "DB_MAX_OPEN_CONNS": "20"}, func(t *testing.T, config Config) {
+			assert.Equal(t, "env-host", config.DB.Hostname)
+			assert.Equal(t, "yaml_user", config.DB.User)
+			assert.Equal(t, "file_pass", config.DB.Password)
+			assert.Equal(t, time.Duration(0), config.DB.QueryTimeout)
+			assert.Equal(t, 20, config.DB.MaxOpenConns)
+		}, false},
+		{"Loads the flags over the environment variables successfully", []string{"--config", yamlFile, "--db-host", "flag-host", "--jwt-secrets-file", secretFile}, map[string]string{"POSTGRES_HOST": "env-host", "JWT_SECRET": "env_secret"}, func(t *testing.T, config Config) {
+			assert.Equal(t, "flag-host", config.DB.Hostname)
+			assert.Equal(t, "file_pass", config.JWTSecrets)
+		}, false},
+		{"Loads fail due to missing config file", []string{"--config", filepath.Join(dir, "missing.yaml")}, nil, nil, true},
+		{"Loads fail due to unsupported config file", []string{"--config", jsonFile}, nil, nil, true},
+		{"Loads fail due to unknown setting of the config file", []string{"--config", unknownFile}, nil, nil, true},
+		{"Loads fail due to invalid environment variable", nil, map[string]string{"DB_QUERY_TIMEOUT": "soon"}, nil, true},
+		{"Loads fail due to invalid number", []string{"--db-max-idle-conns", "many"}, nil, nil, true},
+		{"Loads fail due to missing secret file", []string{"--db-password-file", filepath.Join(dir, "missing")}, nil, nil, true},
+		{"Loads fail due to unknown flag", []string{"--db-hostname", "x"}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookupEnv := func(key string) (string, bool) {
+				value, ok := tt.env[key]
+				return value, ok
+			}
+			config, _, err := LoadConfig(tt.args, lookupEnv)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, config)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	valid := DefaultConfig()
+	valid.DB.User, valid.DB.DBName = "bari_user", "users_db"
+	tests := []struct {
+		name    string
+		change  func(config *Config)
+		wantErr bool
+	}{
+		{"Validates the config successfully", func(config *Config) {}, false},
+		{"Validates the RS256 config successfully", func(config *Config) {
+			config.JWTSigningMethod, config.JWTPrivateKeyFiles = "RS256", "rsa.pem"
+		}, false},
+		{"Validates fail due to invalid port", func(config *Config) { config.Port = "3000" }, true},
+		{"Validates fail due to missing DB user", func(config *Config) { config.DB.User = "" }, true},
+		{"Validates fail due to invalid DB port", func(config *Config) { config.DB.Port = "70000" }, true},
+		{"Validates fail due to invalid DB SSL mode", func(config *Config) { config.DB.SSL = "on" }, true},
+		{"Validates fail due to negative query timeout", func(config *Config) { config.DB.QueryTimeout = -time.Second }, true},
+		{"Validates fail due to negative connect timeout", func(config *Config) { config.DB.ConnectTimeout = -time.Second }, true},
+		{"Validates fail due to connect backoff above its maximum", func(config *Config) { config.DB.ConnectBackoff = time.Minute }, true},
+		{"Validates fail due to negative max open connections", func(config *Config) { config.DB.MaxOpenConns = -1 }, true},
+		{"Validates fail due to unsupported password hash algorithm", func(config *Config) { config.PasswordHashAlgorithm = "md5" }, true},
+		{"Validates fail due to unsupported JWT signing method", func(config *Config) { config.JWTSigningMethod = "none" }, true},
+		{"Validates fail due to missing private key files", func(config *Config) { config.JWTSigningMethod = "EdDSA" }, true},
+		{"Validates fail due to invalid admin email", func(config *Config) { config.AdminEmails = "bari@gmail.com,bari" }, true},
+		{"Validates the trusted proxies successfully", func(config *Config) { config.TrustedProxies = "10.0.0.0/8, 192.168.1.2" }, false},
+		{"Validates fail due to invalid trusted proxy", func(config *Config) { config.TrustedProxies = "10.0.0.0/8,proxy" }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.change(&config)
+			if err := config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_PrintRedacted(t *testing.T) {
+	config, printConfig, err := LoadConfig([]string{"--print-config", "--db-password", "bari_pass"}, func(string) (string, bool) { return "", false })
+	require.NoError(t, err)
+	assert.True(t, printConfig)
+	out := bytes.Buffer{}
+	require.NoError(t, config.PrintRedacted(&out))
+	assert.NotContains(t, out.String(), "bari_pass")
+	assert.Contains(t, out.String(), "password: "+Redacted)
+	assert.Contains(t, out.String(), "jwt_secrets: \"\"")
+	assert.Contains(t, out.String(), "query_timeout: 5s")
+	assert.Contains(t, out.String(), "host: "+Host)
+}
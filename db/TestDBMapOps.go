@@ -1,65 +1,606 @@
 package db
 
 import (
-	"database/sql"
-	"fmt"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"gin_CRUD_server/models"
 )
 
+// The lengths of the columns of the users table
+const (
+	maxEmailLength = 200
+	maxNameLength  = 50
+)
+
+// TestMapOps is an in-memory DB, the users are keyed by their lowercase email. Its operations
+// are serialized so it can be used concurrently like the SQL DB
 type TestMapOps struct {
-	Name  string
-	Users map[string]models.User
+	Name          string
+	Users         map[string]models.User
+	RefreshTokens map[string]models.RefreshToken
+	// Audit are the audit entries keyed by the user ID
+	Audit map[string][]models.AuditEntry
+	mu    *sync.RWMutex
+}
+
+// NewTestMapOps returns a new empty map DB
+func NewTestMapOps(name string) TestMapOps {
+	return TestMapOps{
+		Name:          name,
+		Users:         make(map[string]models.User),
+		RefreshTokens: make(map[string]models.RefreshToken),
+		Audit:         make(map[string][]models.AuditEntry),
+		mu:            &sync.RWMutex{},
+	}
 }
 
 // GetAllUsers gets a list of all the users
-func (DB TestMapOps) GetAllUsers() ([]models.User, error) {
-	var users []models.User
-	if len(DB.Users) == 0 {
-		return users, fmt.Errorf("there are no users")
+func (DB TestMapOps) GetAllUsers(ctx context.Context) ([]models.User, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
 	}
+	DB.mu.RLock()
+	defer DB.mu.RUnlock()
+	var users []models.User
 	for _, user := range DB.Users {
 		users = append(users, user)
 	}
 	return users, nil
 }
 
+// ListUsers gets a page of the users according to the sorting and filtering options
+func (DB TestMapOps) ListUsers(ctx context.Context, opts models.ListUsersOptions) (*models.UsersPage, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	DB.mu.RLock()
+	defer DB.mu.RUnlock()
+	page := &models.UsersPage{Users: []models.User{}}
+	if !models.IsValidSortBy(opts.SortBy) {
+		return page, models.NewError(models.CodeInvalidRequest, "cannot sort users by %q", opts.SortBy)
+	}
+	if opts.Limit < 1 {
+		return page, models.NewError(models.CodeInvalidValue, "the limit must be at least 1, not %d", opts.Limit)
+	}
+	cursor, err := opts.DecodeCursor()
+	if err != nil {
+		return page, err
+	}
+	var users []models.User
+	for _, user := range DB.Users {
+		if !opts.Matches(user) {
+			continue
+		}
+		if cursor != nil && !isAfterCursor(user, cursor, opts) {
+			continue
+		}
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return isAfterCursor(users[j], &models.UsersCursor{Value: users[i].SortValue(opts.SortBy), Email: users[i].Email}, opts)
+	})
+	if len(users) > opts.Limit {
+		users = users[:opts.Limit]
+		page.NextCursor = opts.Cursor(users[opts.Limit-1])
+	}
+	page.Users = append(page.Users, users...)
+	return page, nil
+}
+
+// isAfterCursor reports whether the user comes after the cursor in the order of the options
+func isAfterCursor(user models.User, cursor *models.UsersCursor, opts models.ListUsersOptions) bool {
+	cmp := compareSortValues(user.SortValue(opts.SortBy), cursor.Value, opts.SortBy)
+	if cmp == 0 {
+		cmp = strings.Compare(user.Email, cursor.Email)
+	}
+	if opts.Desc {
+		return cmp < 0
+	}
+	return cmp > 0
+}
+
+// compareSortValues compares the values according to the sort field, dates are compared as times
+func compareSortValues(a, b, sortBy string) int {
+	if sortBy == models.SortByCreatedAt {
+		timeA, errA := time.Parse(time.RFC3339Nano, a)
+		timeB, errB := time.Parse(time.RFC3339Nano, b)
+		if errA == nil && errB == nil {
+			switch {
+			case timeA.Before(timeB):
+				return -1
+			case timeA.After(timeB):
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// SearchUsers gets the users matching all the search terms by word prefix, substring or
+// Levenshtein distance (the equivalent of the tsvector & pg_trgm search) ranked by relevance
+func (DB TestMapOps) SearchUsers(ctx context.Context, query string, limit int) ([]models.UserSearchResult, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	DB.mu.RLock()
+	defer DB.mu.RUnlock()
+	results := []models.UserSearchResult{}
+	terms := models.SearchTerms(query)
+	if len(terms) == 0 {
+		return results, nil
+	}
+	for _, user := range DB.Users {
+		if rank, ok := searchRank(user, terms); ok {
+			results = append(results, models.NewUserSearchResult(user, rank, terms))
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].User.Email < results[j].User.Email
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// searchRank returns the average score of the terms, a word prefix scores 1, a substring
+// scores 0.75 and a word within the allowed edit distance scores up to 0.5
+func searchRank(user models.User, terms []string) (float64, bool) {
+	text := strings.ToLower(user.Name + " " + user.Email)
+	words := models.SearchTerms(text)
+	var total float64
+	for _, term := range terms {
+		best := 0.0
+		for _, word := range words {
+			if strings.HasPrefix(word, term) {
+				best = 1
+				break
+			}
+			if dist := levenshtein(term, word); dist <= maxEdits(term) {
+				if score := 0.5 * (1 - float64(dist)/float64(len([]rune(term)))); score > best {
+					best = score
+				}
+			}
+		}
+		if best < 0.75 && strings.Contains(text, term) {
+			best = 0.75
+		}
+		if best == 0 {
+			return 0, false
+		}
+		total += best
+	}
+	return total / float64(len(terms)), true
+}
+
+// maxEdits returns the edit distance allowed for the term according to its length
+func maxEdits(term string) int {
+	switch n := len([]rune(term)); {
+	case n <= 2:
+		return 0
+	case n <= 5:
+		return 1
+	}
+	return 2
+}
+
+// levenshtein returns the edit distance between the strings
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// min3 returns the minimum of the numbers
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
 // DeleteUser deletes an existing user in the users map
-func (DB TestMapOps) DeleteUser(email string) error {
-	if _, ok := DB.Users[email]; !ok {
-		return sql.ErrNoRows
-	} else {
-		delete(DB.Users, email)
+func (DB TestMapOps) DeleteUser(ctx context.Context, email string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	DB.mu.Lock()
+	defer DB.mu.Unlock()
+	return DB.deleteUser(ctx, email)
+}
+
+// deleteUser deletes an existing user and its refresh tokens
+func (DB TestMapOps) deleteUser(ctx context.Context, email string) error {
+	val, ok := DB.Users[emailKey(email)]
+	if !ok {
+		return models.ErrUserNotFound
+	}
+	delete(DB.Users, emailKey(email))
+	DB.audit(ctx, models.AuditDelete, &val, nil)
+	for hash, token := range DB.RefreshTokens {
+		if token.UserID == val.ID {
+			delete(DB.RefreshTokens, hash)
+		}
 	}
 	return nil
 }
 
-// InsertNewUser inserts a new user into the users map
-func (DB TestMapOps) InsertNewUser(user models.User) error {
-	if user.Email != "" {
-		DB.Users[user.Email] = user
+// DeleteUserByID deletes an existing user in the users map, given a non-zero version
+// only if the user still has this version
+func (DB TestMapOps) DeleteUserByID(ctx context.Context, id string, version int64) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	DB.mu.Lock()
+	defer DB.mu.Unlock()
+	user, err := DB.getUserVersion(id, version)
+	if err != nil {
+		return err
+	}
+	return DB.deleteUser(ctx, user.Email)
+}
+
+// InsertNewUser inserts a new user into the users map, the user gets the member role.
+// Like the users table the email and the ID must be unique
+func (DB TestMapOps) InsertNewUser(ctx context.Context, user models.User) error {
+	if err := checkContext(ctx); err != nil {
+		return err
 	}
+	DB.mu.Lock()
+	defer DB.mu.Unlock()
+	if err := checkUserValues(user); err != nil {
+		return err
+	}
+	if _, ok := DB.Users[emailKey(user.Email)]; ok {
+		return models.ErrEmailTaken
+	}
+	if user.ID == "" {
+		user.ID = models.NewUserID()
+	} else if _, err := DB.getUserByID(user.ID); err == nil {
+		return models.NewError(models.CodeAlreadyExists, "the user already exists")
+	}
+	if user.CreatedAt == "" {
+		user.CreatedAt = time.Now().Format(time.RFC3339Nano)
+	}
+	user.UpdatedAt = user.CreatedAt
+	user.Version = 1
+	user.Roles = []string{models.RoleMember}
+	DB.Users[emailKey(user.Email)] = user
+	DB.audit(ctx, models.AuditCreate, nil, &user)
 	return nil
 }
 
 // UpdateNameAndPassUser updates the name and pass for an existing user in the users map
-func (DB TestMapOps) UpdateNameAndPassUser(user models.User) error {
-	if val, ok := DB.Users[user.Email]; !ok {
-		return sql.ErrNoRows
+func (DB TestMapOps) UpdateNameAndPassUser(ctx context.Context, user models.User) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	DB.mu.Lock()
+	defer DB.mu.Unlock()
+	if err := checkUserValues(user); err != nil {
+		return err
+	}
+	if val, ok := DB.Users[emailKey(user.Email)]; !ok {
+		return models.ErrUserNotFound
+	} else if user.Version != 0 && user.Version != val.Version {
+		return models.ErrVersionConflict
 	} else {
+		before := val
 		val.Name = user.Name
 		val.Password = user.Password
-		DB.Users[user.Email] = val
+		DB.touchUser(val)
+		DB.audit(ctx, models.AuditUpdate, &before, &val)
+	}
+	return nil
+}
+
+// PatchUser updates only the fields of the patch for an existing user in the users map
+func (DB TestMapOps) PatchUser(ctx context.Context, id string, patch models.UserPatch) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	DB.mu.Lock()
+	defer DB.mu.Unlock()
+	user, err := DB.getUserVersion(id, patch.Version)
+	if err != nil {
+		return err
+	}
+	before := *user
+	if patch.Name != nil {
+		user.Name = *patch.Name
+	}
+	if patch.Password != nil {
+		user.Password = *patch.Password
+	}
+	if err = checkUserValues(*user); err != nil {
+		return err
 	}
+	DB.touchUser(*user)
+	DB.audit(ctx, models.AuditUpdate, &before, user)
 	return nil
 }
 
 // IsExistsInUsersTable checks if the usr exists in the users map
-func (DB TestMapOps) IsExistsInUsersTable(email string) (*models.User, error) {
+func (DB TestMapOps) IsExistsInUsersTable(ctx context.Context, email string) (*models.User, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	DB.mu.RLock()
+	defer DB.mu.RUnlock()
 	var user models.User
-	if val, ok := DB.Users[email]; !ok {
-		return &user, sql.ErrNoRows
+	if val, ok := DB.Users[emailKey(email)]; !ok {
+		return &user, models.ErrUserNotFound
 	} else {
 		return &val, nil
 	}
 }
+
+// GetUserByID gets the user according to its ID
+func (DB TestMapOps) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	DB.mu.RLock()
+	defer DB.mu.RUnlock()
+	return DB.getUserByID(id)
+}
+
+// getUserByID finds the user according to its ID
+func (DB TestMapOps) getUserByID(id string) (*models.User, error) {
+	for _, val := range DB.Users {
+		if val.ID == id {
+			return &val, nil
+		}
+	}
+	return &models.User{}, models.ErrUserNotFound
+}
+
+// ChangeEmail changes the email of the user, the new email must not be used by another user
+func (DB TestMapOps) ChangeEmail(ctx context.Context, id, email string, version int64) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	DB.mu.Lock()
+	defer DB.mu.Unlock()
+	user, err := DB.getUserVersion(id, version)
+	if err != nil {
+		return err
+	}
+	if val, ok := DB.Users[emailKey(email)]; ok && val.ID != id {
+		return models.ErrEmailTaken
+	}
+	if err = checkUserValues(models.User{Email: email, Name: user.Name}); err != nil {
+		return err
+	}
+	before := *user
+	delete(DB.Users, emailKey(user.Email))
+	user.Email = email
+	DB.touchUser(*user)
+	DB.audit(ctx, models.AuditUpdate, &before, user)
+	return nil
+}
+
+// getUserVersion gets the user according to its ID, given a non-zero version
+// it returns ErrVersionConflict if the user has another version
+func (DB TestMapOps) getUserVersion(id string, version int64) (*models.User, error) {
+	user, err := DB.getUserByID(id)
+	if err == nil && version != 0 && user.Version != version {
+		return user, models.ErrVersionConflict
+	}
+	return user, err
+}
+
+// touchUser stores the changed user with its next version
+func (DB TestMapOps) touchUser(user models.User) {
+	user.Version++
+	user.UpdatedAt = time.Now().Format(time.RFC3339Nano)
+	DB.Users[emailKey(user.Email)] = user
+}
+
+// checkUserValues returns ErrInvalid when a value doesn't fit its column of the users table
+func checkUserValues(user models.User) error {
+	if user.Email == "" {
+		return invalidValue("email", "the email is required")
+	}
+	if utf8.RuneCountInString(user.Email) > maxEmailLength {
+		return invalidValue("email", "the email is invalid")
+	}
+	if utf8.RuneCountInString(user.Name) > maxNameLength {
+		return invalidValue("username", "the username is invalid")
+	}
+	return nil
+}
+
+// audit appends the audit entry of the change of the user, the IDs of the entries are sequential
+func (DB TestMapOps) audit(ctx context.Context, action string, before, after *models.User) {
+	entry := models.NewAuditEntry(ctx, action, before, after)
+	entry.ID = 1
+	for _, entries := range DB.Audit {
+		entry.ID += int64(len(entries))
+	}
+	DB.Audit[entry.UserID] = append(DB.Audit[entry.UserID], entry)
+}
+
+// GetUserAudit gets the audit entries of the user in the order of the changes
+func (DB TestMapOps) GetUserAudit(ctx context.Context, id string) ([]models.AuditEntry, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	DB.mu.RLock()
+	defer DB.mu.RUnlock()
+	return append([]models.AuditEntry{}, DB.Audit[id]...), nil
+}
+
+// emailKey returns the key of the email in the users map (emails are case-insensitive)
+func emailKey(email string) string {
+	return strings.ToLower(email)
+}
+
+// InsertRefreshToken inserts a new refresh token into the refresh tokens map
+func (DB TestMapOps) InsertRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	DB.mu.Lock()
+	defer DB.mu.Unlock()
+	if _, err := DB.getUserByID(token.UserID); err != nil {
+		return err
+	}
+	DB.RefreshTokens[token.Hash] = token
+	return nil
+}
+
+// GetRefreshToken gets the refresh token according to its hash
+func (DB TestMapOps) GetRefreshToken(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	DB.mu.RLock()
+	defer DB.mu.RUnlock()
+	var token models.RefreshToken
+	if val, ok := DB.RefreshTokens[hash]; !ok {
+		return &token, models.ErrRefreshTokenNotFound
+	} else {
+		return &val, nil
+	}
+}
+
+// RevokeRefreshToken revokes an active refresh token in the refresh tokens map
+func (DB TestMapOps) RevokeRefreshToken(ctx context.Context, hash string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	DB.mu.Lock()
+	defer DB.mu.Unlock()
+	if val, ok := DB.RefreshTokens[hash]; !ok || val.RevokedAt != nil {
+		return models.ErrRefreshTokenNotFound
+	} else {
+		now := time.Now()
+		val.RevokedAt = &now
+		DB.RefreshTokens[hash] = val
+	}
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes all the active refresh tokens of the user in the refresh tokens map
+func (DB TestMapOps) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	DB.mu.Lock()
+	defer DB.mu.Unlock()
+	now := time.Now()
+	for hash, token := range DB.RefreshTokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			DB.RefreshTokens[hash] = token
+		}
+	}
+	return nil
+}
+
+// GrantRole grants the role to an existing user in the users map
+func (DB TestMapOps) GrantRole(ctx context.Context, email, role string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	DB.mu.Lock()
+	defer DB.mu.Unlock()
+	user, ok := DB.Users[emailKey(email)]
+	if !ok {
+		return models.ErrUserNotFound
+	}
+	if !models.IsValidRole(role) {
+		return models.NewError(models.CodeRoleNotFound, "the role %s doesn't exist", role)
+	}
+	for _, r := range user.Roles {
+		if r == role {
+			return nil
+		}
+	}
+	before := user
+	user.Roles = append(append([]string{}, user.Roles...), role)
+	sort.Strings(user.Roles)
+	DB.touchUser(user)
+	DB.audit(ctx, models.AuditUpdate, &before, &user)
+	return nil
+}
+
+// RevokeRole revokes the role of the user in the users map
+func (DB TestMapOps) RevokeRole(ctx context.Context, email, role string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	DB.mu.Lock()
+	defer DB.mu.Unlock()
+	user, ok := DB.Users[emailKey(email)]
+	if !ok {
+		return models.ErrUserNotFound
+	}
+	for i, r := range user.Roles {
+		if r == role {
+			before := user
+			user.Roles = append(user.Roles[:i:i], user.Roles[i+1:]...)
+			DB.touchUser(user)
+			DB.audit(ctx, models.AuditUpdate, &before, &user)
+			return nil
+		}
+	}
+	return models.ErrRoleNotGranted
+}
+
+// GetRolesPermissions gets the permissions granted by the roles
+func (DB TestMapOps) GetRolesPermissions(ctx context.Context, roles []string) ([]string, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	set := map[string]bool{}
+	for _, role := range roles {
+		for _, permission := range models.RolePermissions[role] {
+			set[permission] = true
+		}
+	}
+	permissions := []string{}
+	for permission := range set {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	return permissions, nil
+}
+
+// Ping checks that the context isn't done, the map DB is always available
+func (DB TestMapOps) Ping(ctx context.Context) error {
+	return checkContext(ctx)
+}
+
+// SchemaVersion returns the current schema version, the map DB needs no migrations
+func (DB TestMapOps) SchemaVersion(ctx context.Context) (int64, bool, error) {
+	return SchemaVersion, false, checkContext(ctx)
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+
+	"gin_CRUD_server/models"
+)
+
+const (
+	InsertAuditEntryQuery = `INSERT INTO user_audit ("user_id", "action", "actor_id", "changes", "client_ip", "request_id") VALUES ($1, $2, NULLIF($3, '')::UUID, $4, NULLIF($5, ''), NULLIF($6, ''))`
+	GetUserAuditQuery     = `SELECT id, user_id, action, COALESCE(actor_id::text, ''), changes, COALESCE(client_ip, ''), COALESCE(request_id, ''), created_at FROM user_audit WHERE user_id=$1 ORDER BY id`
+)
+
+// insertAuditEntry inserts the audit entry in the transaction of the change of the user
+func insertAuditEntry(ctx context.Context, tx conn, entry models.AuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, InsertAuditEntryQuery, entry.UserID, entry.Action, entry.ActorID, string(changes), entry.ClientIP, entry.RequestID)
+	return translateError(err)
+}
+
+// GetUserAudit gets the audit entries of the user in the order of the changes, the entries of
+// the deleted users are kept
+func (DB SqlOps) GetUserAudit(ctx context.Context, id string) ([]models.AuditEntry, error) {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
+	entries := []models.AuditEntry{}
+	if !models.IsUserID(id) {
+		return entries, nil
+	}
+	rows, err := traced(DB.Db).QueryContext(ctx, GetUserAuditQuery, id)
+	if err != nil {
+		return entries, translateError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry models.AuditEntry
+		var changes []byte
+		if err = rows.Scan(&entry.ID, &entry.UserID, &entry.Action, &entry.ActorID, &changes, &entry.ClientIP, &entry.RequestID, &entry.CreatedAt); err != nil {
+			return entries, translateError(err)
+		}
+		if err = json.Unmarshal(changes, &entry.Changes); err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, translateError(rows.Err())
+}
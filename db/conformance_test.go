@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"gin_CRUD_server/db/dbtest"
+	"gin_CRUD_server/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDBOpsConformance(t *testing.T) {
+	t.Run("Map DB", func(t *testing.T) {
+		dbtest.Run(t, func(t *testing.T) models.DBOps {
+			return NewTestMapOps("Map DB Conformance")
+		})
+	})
+	t.Run("SQL DB", func(t *testing.T) {
+		url := os.Getenv(dbtest.PostgresURLEnv)
+		if url == "" {
+			t.Skipf("%s isn't set", dbtest.PostgresURLEnv)
+		}
+		conn, err := sql.Open("postgres", url)
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, conn.Ping())
+		version, dirty, err := SqlOps{Db: conn}.SchemaVersion(context.Background())
+		require.NoError(t, err)
+		require.False(t, dirty)
+		require.Equal(t, int64(SchemaVersion), version, "the DB isn't migrated to the schema version")
+		dbtest.Run(t, sqlOpsFactory(conn))
+	})
+}
+
+// sqlOpsFactory returns the factory of the SQL DB using the connection, the tables are truncated for each test
+func sqlOpsFactory(conn *sql.DB) dbtest.Factory {
+	return func(t *testing.T) models.DBOps {
+		require.NoError(t, dbtest.TruncateTables(conn))
+		return SqlOps{Name: "SQL DB Conformance", Db: conn}
+	}
+}
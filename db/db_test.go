@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_pingWithRetry(t *testing.T) {
+	errNotReady := errors.New("the database system is starting up")
+	config := &Config{ConnectTimeout: time.Second, ConnectBackoff: time.Millisecond, ConnectMaxBackoff: 4 * time.Millisecond}
+	tests := []struct {
+		name         string
+		config       *Config
+		failures     int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{"Connects at the first attempt without waiting", config, 0, 1, false},
+		{"Connects once the DB is ready", config, 5, 6, false},
+		{"Connects fail due to a single attempt", &Config{}, 1, 1, true},
+		{"Connects fail due to the connect timeout", &Config{ConnectTimeout: 20 * time.Millisecond, ConnectBackoff: time.Millisecond, ConnectMaxBackoff: 2 * time.Millisecond}, 1000, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			ping := func(ctx context.Context) error {
+				if attempts++; attempts <= tt.failures {
+					return errNotReady
+				}
+				return nil
+			}
+			err := pingWithRetry(context.Background(), ping, tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("pingWithRetry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				assert.ErrorIs(t, err, errNotReady)
+			}
+			if tt.wantAttempts > 0 {
+				assert.Equal(t, tt.wantAttempts, attempts)
+			}
+		})
+	}
+}
+
+func Test_withJitter(t *testing.T) {
+	for _, backoff := range []time.Duration{0, 1, time.Millisecond, time.Second} {
+		for i := 0; i < 100; i++ {
+			delay := withJitter(backoff)
+			assert.True(t, delay >= backoff/2 && delay <= backoff, "withJitter(%s) = %s", backoff, delay)
+		}
+	}
+}
+
+func Test_configurePool(t *testing.T) {
+	// Opening the DB doesn't connect, so the pool settings are checked without a DB
+	conn, err := sql.Open("postgres", "postgres://localhost:1/users_db")
+	assert.NoError(t, err)
+	defer conn.Close()
+	configurePool(conn, &Config{MaxOpenConns: 7, MaxIdleConns: 3, ConnMaxLifetime: time.Minute})
+	stats := SqlOps{Db: conn}.PoolStats()
+	assert.Equal(t, 7, stats.MaxOpenConnections)
+	assert.Equal(t, 0, stats.OpenConnections)
+}
+
+func TestSchemaVersion(t *testing.T) {
+	// The schema version is the version of the last migration
+	files, err := filepath.Glob(filepath.Join("migrations", "*.up.sql"))
+	assert.NoError(t, err)
+	sort.Strings(files)
+	last := filepath.Base(files[len(files)-1])
+	assert.Equal(t, fmt.Sprintf("%06d", SchemaVersion), strings.SplitN(last, "_", 2)[0])
+}
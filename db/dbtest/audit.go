@@ -0,0 +1,100 @@
+package dbtest
+
+import (
+	"testing"
+
+	"gin_CRUD_server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// actorID is the ID of the actor of the audited changes
+const actorID = "0b5cf4a6-3d6e-4b6e-9d0f-6a5f1a3c2e11"
+
+var auditTests = []test{
+	{"Audits the creation of the user", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		entries, err := dbOps.GetUserAudit(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, user.ID, entries[0].UserID)
+		assert.Equal(t, models.AuditCreate, entries[0].Action)
+		assert.Empty(t, entries[0].ActorID)
+		assert.Equal(t, auditChange(nil, TestEmail), entries[0].Changes["email"])
+		assert.Equal(t, auditChange(nil, models.AuditRedacted), entries[0].Changes["password"])
+		assert.NotEmpty(t, entries[0].CreatedAt)
+	}},
+	{"Audits the updates with the actor of the context and the password redacted", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		auditCtx := models.WithAuditInfo(ctx, models.AuditInfo{ActorID: actorID, ClientIP: "10.0.0.1", RequestID: "request-1"})
+		require.NoError(t, dbOps.UpdateNameAndPassUser(auditCtx, models.User{Email: TestEmail, Name: "bari2", Password: "5678"}))
+		entries, err := dbOps.GetUserAudit(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		entry := entries[1]
+		assert.Greater(t, entry.ID, entries[0].ID)
+		assert.Equal(t, models.AuditUpdate, entry.Action)
+		assert.Equal(t, actorID, entry.ActorID)
+		assert.Equal(t, "10.0.0.1", entry.ClientIP)
+		assert.Equal(t, "request-1", entry.RequestID)
+		assert.Equal(t, map[string]models.AuditChange{
+			"name":     auditChange("bari", "bari2"),
+			"password": auditChange(models.AuditRedacted, models.AuditRedacted),
+		}, entry.Changes)
+	}},
+	{"Audits only the changed fields of the patch and the email change", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		name := "bari2"
+		require.NoError(t, dbOps.PatchUser(ctx, user.ID, models.UserPatch{Name: &name}))
+		require.NoError(t, dbOps.ChangeEmail(ctx, user.ID, "changed@gmail.com", 0))
+		entries, err := dbOps.GetUserAudit(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, entries, 3)
+		assert.Equal(t, map[string]models.AuditChange{"name": auditChange("bari", "bari2")}, entries[1].Changes)
+		assert.Equal(t, map[string]models.AuditChange{"email": auditChange(TestEmail, "changed@gmail.com")}, entries[2].Changes)
+	}},
+	{"Keeps the audit entries after the deletion", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		require.NoError(t, dbOps.DeleteUserByID(ctx, user.ID, 1))
+		entries, err := dbOps.GetUserAudit(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, models.AuditDelete, entries[1].Action)
+		assert.Equal(t, auditChange("bari", nil), entries[1].Changes["name"])
+	}},
+	{"Audits the granted and revoked roles", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		auditCtx := models.WithAuditInfo(ctx, models.AuditInfo{ActorID: actorID})
+		require.NoError(t, dbOps.GrantRole(auditCtx, TestEmail, models.RoleAdmin))
+		require.NoError(t, dbOps.GrantRole(auditCtx, TestEmail, models.RoleAdmin))
+		require.NoError(t, dbOps.RevokeRole(auditCtx, TestEmail, models.RoleMember))
+		assert.ErrorIs(t, dbOps.RevokeRole(auditCtx, TestEmail, models.RoleMember), models.ErrRoleNotGranted)
+		entries, err := dbOps.GetUserAudit(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, entries, 3)
+		assert.Equal(t, actorID, entries[1].ActorID)
+		assert.Equal(t, map[string]models.AuditChange{"roles": auditChange("member", "admin,member")}, entries[1].Changes)
+		assert.Equal(t, map[string]models.AuditChange{"roles": auditChange("admin,member", "admin")}, entries[2].Changes)
+	}},
+	{"Doesn't audit the failed changes", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		name := "bari2"
+		assert.ErrorIs(t, dbOps.PatchUser(ctx, user.ID, models.UserPatch{Name: &name, Version: 2}), models.ErrVersionConflict)
+		assert.ErrorIs(t, dbOps.DeleteUser(ctx, UnknownEmail), models.ErrUserNotFound)
+		entries, err := dbOps.GetUserAudit(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	}},
+	{"Gets no audit entries of an unknown user", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		for _, id := range []string{actorID, "not-a-uuid"} {
+			entries, err := dbOps.GetUserAudit(ctx, id)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		}
+	}},
+}
+
+// auditChange returns the audit change from old to new, the values are strings or nil
+func auditChange(old, new interface{}) models.AuditChange {
+	value := func(v interface{}) *string {
+		if s, ok := v.(string); ok {
+			return &s
+		}
+		return nil
+	}
+	return models.AuditChange{Old: value(old), New: value(new)}
+}
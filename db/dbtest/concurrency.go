@@ -0,0 +1,95 @@
+package dbtest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gin_CRUD_server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// concurrency is the number of concurrent operations of the concurrency tests
+const concurrency = 8
+
+var concurrencyTests = []test{
+	{"Inserts the same email concurrently only once", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		errs := runConcurrently(func(i int) error {
+			return dbOps.InsertNewUser(ctx, *models.NewUser("same@gmail.com", fmt.Sprintf("user%d", i), "1234"))
+		})
+		assert.Equal(t, 1, countErrors(errs, nil))
+		assert.Equal(t, concurrency-1, countErrors(errs, models.ErrEmailTaken))
+	}},
+	{"Updates the same version concurrently only once", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		errs := runConcurrently(func(i int) error {
+			return dbOps.UpdateNameAndPassUser(ctx, models.User{Email: TestEmail, Name: fmt.Sprintf("user%d", i), Password: "5678", Version: 1})
+		})
+		assert.Equal(t, 1, countErrors(errs, nil))
+		assert.Equal(t, concurrency-1, countErrors(errs, models.ErrVersionConflict))
+		updated, err := dbOps.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), updated.Version)
+	}},
+	{"Patches different fields concurrently without losing any", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		name, password := "bari2", "5678"
+		errs := runConcurrently(func(i int) error {
+			if i%2 == 0 {
+				return dbOps.PatchUser(ctx, user.ID, models.UserPatch{Name: &name})
+			}
+			return dbOps.PatchUser(ctx, user.ID, models.UserPatch{Password: &password})
+		})
+		assert.Equal(t, concurrency, countErrors(errs, nil))
+		patched, err := dbOps.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, name, patched.Name)
+		assert.Equal(t, password, patched.Password)
+		assert.Equal(t, int64(1+concurrency), patched.Version)
+	}},
+	{"Revokes the refresh token concurrently only once", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		require.NoError(t, dbOps.InsertRefreshToken(ctx, *models.NewRefreshToken("hash", user.ID, time.Now().Add(time.Hour))))
+		errs := runConcurrently(func(int) error {
+			return dbOps.RevokeRefreshToken(ctx, "hash")
+		})
+		assert.Equal(t, 1, countErrors(errs, nil))
+		assert.Equal(t, concurrency-1, countErrors(errs, models.ErrRefreshTokenNotFound))
+	}},
+	{"Deletes the user concurrently only once", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		errs := runConcurrently(func(int) error {
+			return dbOps.DeleteUserByID(ctx, user.ID, 1)
+		})
+		assert.Equal(t, 1, countErrors(errs, nil))
+		assert.Equal(t, concurrency-1, countErrors(errs, models.ErrUserNotFound))
+	}},
+}
+
+// runConcurrently runs the operation concurrently and returns the error of each run
+func runConcurrently(operation func(i int) error) []error {
+	errs := make([]error, concurrency)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			errs[i] = operation(i)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return errs
+}
+
+// countErrors returns the number of errors matching the target, or the number of nil errors
+func countErrors(errs []error, target error) int {
+	count := 0
+	for _, err := range errs {
+		if (target == nil && err == nil) || (target != nil && errors.Is(err, target)) {
+			count++
+		}
+	}
+	return count
+}
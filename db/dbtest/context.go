@@ -0,0 +1,33 @@
+package dbtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gin_CRUD_server/models"
+	"github.com/stretchr/testify/assert"
+)
+
+var contextTests = []test{
+	{"Operations fail due to the canceled context", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := dbOps.GetUserByID(canceled, user.ID)
+		assert.ErrorIs(t, err, models.ErrUnavailable)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.ErrorIs(t, dbOps.InsertNewUser(canceled, *models.NewUser("other@gmail.com", "other", "1234")), models.ErrUnavailable)
+		_, err = dbOps.IsExistsInUsersTable(ctx, "other@gmail.com")
+		assert.ErrorIs(t, err, models.ErrUserNotFound)
+	}},
+	{"Operations fail due to the exceeded deadline", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		expired, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+		defer cancel()
+		_, err := dbOps.ListUsers(expired, models.NewListUsersOptions())
+		assert.ErrorIs(t, err, models.ErrTimeout)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		name := "bari2"
+		assert.ErrorIs(t, dbOps.PatchUser(expired, user.ID, models.UserPatch{Name: &name}), models.ErrTimeout)
+		assertUnchanged(t, dbOps, user)
+	}},
+}
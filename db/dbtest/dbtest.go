@@ -0,0 +1,283 @@
+// Package dbtest is the conformance test suite of the models.DBOps implementations, it checks
+// every DB has the same behaviour so the handlers tested with the map DB work with the SQL DB
+package dbtest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"gin_CRUD_server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	TestEmail    = "bari@gmail.com"
+	UnknownEmail = "unknown@gmail.com"
+)
+
+// ctx is the context of the DB operations of the tests
+var ctx = context.Background()
+
+// Factory returns a new empty DB, it is called by each test
+type Factory func(t *testing.T) models.DBOps
+
+// test is a conformance test run against the DB with the test user already inserted
+type test struct {
+	name string
+	run  func(t *testing.T, dbOps models.DBOps, user *models.User)
+}
+
+// Run runs the conformance tests against the DBs of the factory
+func Run(t *testing.T, newDB Factory) {
+	groups := []struct {
+		name  string
+		tests []test
+	}{
+		{"CRUD", crudTests},
+		{"Not found", notFoundTests},
+		{"Duplicates", duplicateTests},
+		{"Roles & tokens", roleAndTokenTests},
+		{"Ordering", orderingTests},
+		{"Concurrency", concurrencyTests},
+		{"Context", contextTests},
+		{"Audit", auditTests},
+	}
+	for _, group := range groups {
+		t.Run(group.name, func(t *testing.T) {
+			for _, tt := range group.tests {
+				t.Run(tt.name, func(t *testing.T) {
+					dbOps := newDB(t)
+					user := models.NewUser(TestEmail, "bari", "1234")
+					require.NoError(t, dbOps.InsertNewUser(ctx, *user))
+					tt.run(t, dbOps, user)
+				})
+			}
+		})
+	}
+}
+
+var crudTests = []test{
+	{"Gets the inserted user by its email in another case and by its ID", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		byEmail, err := dbOps.IsExistsInUsersTable(ctx, "BARI@gmail.com")
+		require.NoError(t, err)
+		byID, err := dbOps.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, byEmail, byID)
+		assert.Equal(t, TestEmail, byID.Email)
+		assert.Equal(t, "bari", byID.Name)
+		assert.Equal(t, "1234", byID.Password)
+		assert.Equal(t, int64(1), byID.Version)
+		assert.Equal(t, []string{models.RoleMember}, byID.Roles)
+		assert.NotEmpty(t, byID.CreatedAt)
+	}},
+	{"Gets all the users", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		require.NoError(t, dbOps.InsertNewUser(ctx, *models.NewUser("other@gmail.com", "other", "1234")))
+		users, err := dbOps.GetAllUsers(ctx)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{TestEmail, "other@gmail.com"}, emails(users))
+	}},
+	{"Gets no users after the last one is deleted", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		require.NoError(t, dbOps.DeleteUser(ctx, TestEmail))
+		users, err := dbOps.GetAllUsers(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, users)
+	}},
+	{"Updates the name and password", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		require.NoError(t, dbOps.UpdateNameAndPassUser(ctx, models.User{Email: "BARI@gmail.com", Name: "bari2", Password: "5678"}))
+		updated, err := dbOps.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "bari2", updated.Name)
+		assert.Equal(t, "5678", updated.Password)
+		assert.Equal(t, int64(2), updated.Version)
+	}},
+	{"Updates fail due to another version", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		err := dbOps.UpdateNameAndPassUser(ctx, models.User{Email: TestEmail, Name: "bari2", Password: "5678", Version: 2})
+		assert.ErrorIs(t, err, models.ErrVersionConflict)
+		assertUnchanged(t, dbOps, user)
+	}},
+	{"Updates fail due to too long name", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		err := dbOps.UpdateNameAndPassUser(ctx, models.User{Email: TestEmail, Name: strings.Repeat("a", 51), Password: "5678"})
+		assert.ErrorIs(t, err, models.ErrInvalid)
+		assertUnchanged(t, dbOps, user)
+	}},
+	{"Patches only the name", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		name := "bari2"
+		require.NoError(t, dbOps.PatchUser(ctx, user.ID, models.UserPatch{Name: &name, Version: 1}))
+		patched, err := dbOps.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, name, patched.Name)
+		assert.Equal(t, user.Password, patched.Password)
+		assert.Equal(t, int64(2), patched.Version)
+	}},
+	{"Patches fail due to another version", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		name := "bari2"
+		assert.ErrorIs(t, dbOps.PatchUser(ctx, user.ID, models.UserPatch{Name: &name, Version: 2}), models.ErrVersionConflict)
+		assertUnchanged(t, dbOps, user)
+	}},
+	{"Changes the email and keeps the ID", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		require.NoError(t, dbOps.ChangeEmail(ctx, user.ID, "changed@gmail.com", 1))
+		changed, err := dbOps.IsExistsInUsersTable(ctx, "changed@gmail.com")
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, changed.ID)
+		assert.Equal(t, int64(2), changed.Version)
+		_, err = dbOps.IsExistsInUsersTable(ctx, TestEmail)
+		assert.ErrorIs(t, err, models.ErrUserNotFound)
+	}},
+	{"Changes the email case of the user", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		require.NoError(t, dbOps.ChangeEmail(ctx, user.ID, "Bari@gmail.com", 0))
+		changed, err := dbOps.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Bari@gmail.com", changed.Email)
+	}},
+	{"Deletes the user by its email in another case", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		require.NoError(t, dbOps.DeleteUser(ctx, "BARI@gmail.com"))
+		_, err := dbOps.GetUserByID(ctx, user.ID)
+		assert.ErrorIs(t, err, models.ErrUserNotFound)
+	}},
+	{"Deletes the user by its ID and version", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		assert.ErrorIs(t, dbOps.DeleteUserByID(ctx, user.ID, 2), models.ErrVersionConflict)
+		require.NoError(t, dbOps.DeleteUserByID(ctx, user.ID, 1))
+		_, err := dbOps.IsExistsInUsersTable(ctx, TestEmail)
+		assert.ErrorIs(t, err, models.ErrUserNotFound)
+	}},
+}
+
+var notFoundTests = []test{
+	{"Gets fail due to unknown email", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		_, err := dbOps.IsExistsInUsersTable(ctx, UnknownEmail)
+		assert.ErrorIs(t, err, models.ErrUserNotFound)
+	}},
+	{"Gets fail due to unknown or invalid ID", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		_, err := dbOps.GetUserByID(ctx, models.NewUserID())
+		assert.ErrorIs(t, err, models.ErrUserNotFound)
+		_, err = dbOps.GetUserByID(ctx, "abc")
+		assert.ErrorIs(t, err, models.ErrUserNotFound)
+	}},
+	{"Updates fail due to unknown user", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		err := dbOps.UpdateNameAndPassUser(ctx, models.User{Email: UnknownEmail, Name: "bari2", Password: "5678"})
+		assert.ErrorIs(t, err, models.ErrUserNotFound)
+		err = dbOps.UpdateNameAndPassUser(ctx, models.User{Email: UnknownEmail, Name: "bari2", Password: "5678", Version: 1})
+		assert.ErrorIs(t, err, models.ErrUserNotFound)
+	}},
+	{"Patches fail due to unknown user", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		name := "bari2"
+		assert.ErrorIs(t, dbOps.PatchUser(ctx, models.NewUserID(), models.UserPatch{Name: &name}), models.ErrUserNotFound)
+	}},
+	{"Changes the email fail due to unknown user", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		assert.ErrorIs(t, dbOps.ChangeEmail(ctx, models.NewUserID(), "x@gmail.com", 0), models.ErrUserNotFound)
+	}},
+	{"Deletes fail due to unknown user", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		assert.ErrorIs(t, dbOps.DeleteUser(ctx, UnknownEmail), models.ErrUserNotFound)
+		assert.ErrorIs(t, dbOps.DeleteUserByID(ctx, models.NewUserID(), 0), models.ErrUserNotFound)
+		assert.ErrorIs(t, dbOps.DeleteUserByID(ctx, models.NewUserID(), 1), models.ErrUserNotFound)
+	}},
+	{"Deletes fail due to the deleted user", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		require.NoError(t, dbOps.DeleteUser(ctx, TestEmail))
+		assert.ErrorIs(t, dbOps.DeleteUser(ctx, TestEmail), models.ErrUserNotFound)
+	}},
+}
+
+var duplicateTests = []test{
+	{"Inserts fail due to the email in another case", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		err := dbOps.InsertNewUser(ctx, *models.NewUser("BARI@gmail.com", "bari2", "1234"))
+		assert.ErrorIs(t, err, models.ErrEmailTaken)
+		assert.ErrorIs(t, err, models.ErrAlreadyExists)
+		assertUnchanged(t, dbOps, user)
+	}},
+	{"Inserts fail due to the existing ID", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		duplicate := models.NewUser("other@gmail.com", "other", "1234")
+		duplicate.ID = user.ID
+		assert.ErrorIs(t, dbOps.InsertNewUser(ctx, *duplicate), models.ErrAlreadyExists)
+		_, err := dbOps.IsExistsInUsersTable(ctx, "other@gmail.com")
+		assert.ErrorIs(t, err, models.ErrUserNotFound)
+	}},
+	{"Changes the email fail due to the email of another user", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		require.NoError(t, dbOps.InsertNewUser(ctx, *models.NewUser("other@gmail.com", "other", "1234")))
+		assert.ErrorIs(t, dbOps.ChangeEmail(ctx, user.ID, "OTHER@gmail.com", 0), models.ErrEmailTaken)
+		assertUnchanged(t, dbOps, user)
+	}},
+	{"Inserts the email of the deleted user", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		require.NoError(t, dbOps.DeleteUser(ctx, TestEmail))
+		require.NoError(t, dbOps.InsertNewUser(ctx, *models.NewUser(TestEmail, "new", "1234")))
+		inserted, err := dbOps.IsExistsInUsersTable(ctx, TestEmail)
+		require.NoError(t, err)
+		assert.NotEqual(t, user.ID, inserted.ID)
+	}},
+}
+
+var roleAndTokenTests = []test{
+	{"Grants & revokes a role", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		require.NoError(t, dbOps.GrantRole(ctx, TestEmail, models.RoleSupport))
+		require.NoError(t, dbOps.GrantRole(ctx, "BARI@gmail.com", models.RoleSupport))
+		granted, err := dbOps.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{models.RoleMember, models.RoleSupport}, granted.Roles)
+		assert.Equal(t, int64(2), granted.Version)
+		require.NoError(t, dbOps.RevokeRole(ctx, TestEmail, models.RoleSupport))
+		assert.ErrorIs(t, dbOps.RevokeRole(ctx, TestEmail, models.RoleSupport), models.ErrRoleNotGranted)
+	}},
+	{"Grants fail due to unknown user or role", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		assert.ErrorIs(t, dbOps.GrantRole(ctx, UnknownEmail, models.RoleSupport), models.ErrUserNotFound)
+		assert.ErrorIs(t, dbOps.GrantRole(ctx, TestEmail, "root"), models.ErrInvalid)
+		assertUnchanged(t, dbOps, user)
+	}},
+	{"Gets the permissions of the roles", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		permissions, err := dbOps.GetRolesPermissions(ctx, []string{models.RoleSupport, models.RoleMember})
+		require.NoError(t, err)
+		assert.Equal(t, []string{models.PermissionListUsers, models.PermissionReadUsers}, permissions)
+	}},
+	{"Revokes the refresh token once", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		require.NoError(t, dbOps.InsertRefreshToken(ctx, *models.NewRefreshToken("hash", user.ID, time.Now().Add(time.Hour))))
+		token, err := dbOps.GetRefreshToken(ctx, "hash")
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, token.UserID)
+		assert.True(t, token.IsActive())
+		require.NoError(t, dbOps.RevokeRefreshToken(ctx, "hash"))
+		assert.ErrorIs(t, dbOps.RevokeRefreshToken(ctx, "hash"), models.ErrRefreshTokenNotFound)
+		_, err = dbOps.GetRefreshToken(ctx, "unknown")
+		assert.ErrorIs(t, err, models.ErrRefreshTokenNotFound)
+	}},
+	{"Revokes the refresh tokens of the user", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		for _, hash := range []string{"hash1", "hash2"} {
+			require.NoError(t, dbOps.InsertRefreshToken(ctx, *models.NewRefreshToken(hash, user.ID, time.Now().Add(time.Hour))))
+		}
+		require.NoError(t, dbOps.RevokeUserRefreshTokens(ctx, user.ID))
+		for _, hash := range []string{"hash1", "hash2"} {
+			token, err := dbOps.GetRefreshToken(ctx, hash)
+			require.NoError(t, err)
+			assert.False(t, token.IsActive())
+		}
+	}},
+	{"Deletes the refresh tokens of the deleted user", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		require.NoError(t, dbOps.InsertRefreshToken(ctx, *models.NewRefreshToken("hash", user.ID, time.Now().Add(time.Hour))))
+		require.NoError(t, dbOps.DeleteUser(ctx, TestEmail))
+		_, err := dbOps.GetRefreshToken(ctx, "hash")
+		assert.ErrorIs(t, err, models.ErrRefreshTokenNotFound)
+	}},
+	{"Inserts the refresh token fail due to unknown user", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		err := dbOps.InsertRefreshToken(ctx, *models.NewRefreshToken("hash", models.NewUserID(), time.Now().Add(time.Hour)))
+		assert.ErrorIs(t, err, models.ErrUserNotFound)
+	}},
+}
+
+// assertUnchanged asserts the failed operation didn't change the user
+func assertUnchanged(t *testing.T, dbOps models.DBOps, user *models.User) {
+	current, err := dbOps.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, user.Email, current.Email)
+	assert.Equal(t, user.Name, current.Name)
+	assert.Equal(t, user.Password, current.Password)
+	assert.Equal(t, user.Version, current.Version)
+}
+
+// emails returns the emails of the users in order
+func emails(users []models.User) []string {
+	list := []string{}
+	for _, user := range users {
+		list = append(list, user.Email)
+	}
+	return list
+}
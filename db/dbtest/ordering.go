@@ -0,0 +1,83 @@
+package dbtest
+
+import (
+	"testing"
+
+	"gin_CRUD_server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var orderingTests = []test{
+	{"Lists the users by email descending by default", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		insertUsers(t, dbOps)
+		page, err := dbOps.ListUsers(ctx, models.NewListUsersOptions())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"dana@gmail.com", "carl@gmail.com", TestEmail, "adam@gmail.com"}, emails(page.Users))
+		assert.Empty(t, page.NextCursor)
+	}},
+	{"Lists the users by case-insensitive username with ties broken by email", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		insertUsers(t, dbOps)
+		page, err := dbOps.ListUsers(ctx, models.ListUsersOptions{Limit: 10, SortBy: models.SortByUsername})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"adam@gmail.com", "carl@gmail.com", TestEmail, "dana@gmail.com"}, emails(page.Users))
+	}},
+	{"Lists all the pages without duplicates", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		insertUsers(t, dbOps)
+		opts := models.ListUsersOptions{Limit: 3, SortBy: models.SortByEmail}
+		first, err := dbOps.ListUsers(ctx, opts)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"adam@gmail.com", TestEmail, "carl@gmail.com"}, emails(first.Users))
+		require.NotEmpty(t, first.NextCursor)
+		opts.After = first.NextCursor
+		last, err := dbOps.ListUsers(ctx, opts)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"dana@gmail.com"}, emails(last.Users))
+		assert.Empty(t, last.NextCursor)
+	}},
+	{"Lists the users filtered by name", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		insertUsers(t, dbOps)
+		page, err := dbOps.ListUsers(ctx, models.ListUsersOptions{Limit: 10, SortBy: models.SortByEmail, NameContains: "AR"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{TestEmail}, emails(page.Users))
+	}},
+	{"Lists fail due to cursor of another sort", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		opts := models.ListUsersOptions{Limit: 1, SortBy: models.SortByUsername}
+		_, err := dbOps.ListUsers(ctx, models.ListUsersOptions{Limit: 1, SortBy: models.SortByEmail, After: opts.Cursor(*user)})
+		assert.ErrorIs(t, err, models.ErrInvalidCursor)
+	}},
+	{"Lists fail due to limit below 1", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		insertUsers(t, dbOps)
+		for _, limit := range []int{0, -1} {
+			_, err := dbOps.ListUsers(ctx, models.ListUsersOptions{Limit: limit, SortBy: models.SortByEmail})
+			assert.ErrorIs(t, err, models.ErrInvalid)
+		}
+	}},
+	{"Searches the users ranked by relevance", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		insertUsers(t, dbOps)
+		results, err := dbOps.SearchUsers(ctx, "bari", 10)
+		require.NoError(t, err)
+		require.NotEmpty(t, results)
+		assert.Equal(t, TestEmail, results[0].User.Email)
+		assert.Empty(t, results[0].User.Password)
+		for i := 1; i < len(results); i++ {
+			assert.GreaterOrEqual(t, results[i-1].Rank, results[i].Rank)
+		}
+	}},
+	{"Searches nothing due to query without words", func(t *testing.T, dbOps models.DBOps, user *models.User) {
+		results, err := dbOps.SearchUsers(ctx, "&|", 10)
+		require.NoError(t, err)
+		assert.Empty(t, results)
+	}},
+}
+
+// insertUsers inserts the users listed by the ordering tests along the test user (named bari)
+func insertUsers(t *testing.T, dbOps models.DBOps) {
+	for _, user := range []*models.User{
+		models.NewUser("carl@gmail.com", "Adam", "1234"),
+		models.NewUser("adam@gmail.com", "adam", "1234"),
+		models.NewUser("dana@gmail.com", "zoe", "1234"),
+	} {
+		require.NoError(t, dbOps.InsertNewUser(ctx, *user))
+	}
+}
@@ -0,0 +1,52 @@
+package dbtest
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// PostgresURLEnv is the URL of a migrated PostgreSQL DB the SQL DB is tested against, its tables are truncated
+const PostgresURLEnv = "TEST_POSTGRESQL_URL"
+
+// TruncateTables deletes the users and their roles, refresh tokens & audit entries, the roles and permissions are kept.
+// The trigger refusing to truncate the append-only audit entries is disabled meanwhile, which requires the table owner
+func TruncateTables(conn *sql.DB) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, statement := range []string{
+		`ALTER TABLE user_audit DISABLE TRIGGER user_audit_no_truncate`,
+		`TRUNCATE users, user_roles, refresh_tokens, user_audit`,
+		`ALTER TABLE user_audit ENABLE TRIGGER user_audit_no_truncate`,
+	} {
+		if _, err = tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ApplyMigrations applies the up migrations of the directory in order, like the
+// docker-entrypoint-initdb.d scripts of the database service
+func ApplyMigrations(conn *sql.DB, dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		script, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if _, err = conn.Exec(string(script)); err != nil {
+			return fmt.Errorf("migration %s failed: %w", filepath.Base(file), err)
+		}
+	}
+	return nil
+}
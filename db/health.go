@@ -0,0 +1,39 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// SchemaVersion is the version of the last migration of db/migrations, the server is ready only
+// when the DB is migrated to this version (or a later one)
+const SchemaVersion = 11
+
+const GetSchemaVersionQuery = `SELECT version, dirty FROM schema_migrations ORDER BY version DESC LIMIT 1`
+
+// HealthChecker is implemented by the DB operations that check the readiness of their DB
+type HealthChecker interface {
+	Ping(ctx context.Context) error
+	// SchemaVersion returns the version of the last applied migration, it is dirty when the migration failed
+	SchemaVersion(ctx context.Context) (version int64, dirty bool, err error)
+}
+
+// Ping checks the connection to the DB
+func (DB SqlOps) Ping(ctx context.Context) error {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
+	return translateError(DB.Db.PingContext(ctx))
+}
+
+// SchemaVersion returns the version of the last applied migration, zero when none is recorded
+func (DB SqlOps) SchemaVersion(ctx context.Context) (int64, bool, error) {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
+	var version int64
+	var dirty bool
+	err := traced(DB.Db).QueryRowContext(ctx, GetSchemaVersionQuery).Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return version, dirty, translateError(err)
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"gin_CRUD_server/models"
+)
+
+// Observer observes the duration and the error of a DB operation
+type Observer func(operation string, duration time.Duration, err error)
+
+// InstrumentedOps are the wrapped DB operations reporting each operation to the observer
+type InstrumentedOps struct {
+	Ops      models.DBOps
+	Observer Observer
+}
+
+// NewInstrumentedOps returns the DB operations reporting each operation of ops to the observer
+func NewInstrumentedOps(ops models.DBOps, observer Observer) *InstrumentedOps {
+	return &InstrumentedOps{Ops: ops, Observer: observer}
+}
+
+// Unwrap returns the wrapped DB operations
+func (DB InstrumentedOps) Unwrap() models.DBOps {
+	return DB.Ops
+}
+
+// Unwrap returns the innermost DB operations of the wrapped DB operations, so their optional
+// interfaces (PoolStatsProvider, HealthChecker) are found
+func Unwrap(ops models.DBOps) models.DBOps {
+	for {
+		wrapper, ok := ops.(interface{ Unwrap() models.DBOps })
+		if !ok {
+			return ops
+		}
+		ops = wrapper.Unwrap()
+	}
+}
+
+// observe reports the operation started at start and returns its error
+func (DB InstrumentedOps) observe(operation string, start time.Time, err error) error {
+	DB.Observer(operation, time.Since(start), err)
+	return err
+}
+
+// GetAllUsers gets a list of all the users
+func (DB InstrumentedOps) GetAllUsers(ctx context.Context) ([]models.User, error) {
+	start := time.Now()
+	users, err := DB.Ops.GetAllUsers(ctx)
+	return users, DB.observe("GetAllUsers", start, err)
+}
+
+// ListUsers returns a page of the users
+func (DB InstrumentedOps) ListUsers(ctx context.Context, opts models.ListUsersOptions) (*models.UsersPage, error) {
+	start := time.Now()
+	page, err := DB.Ops.ListUsers(ctx, opts)
+	return page, DB.observe("ListUsers", start, err)
+}
+
+// SearchUsers returns the users matching the query
+func (DB InstrumentedOps) SearchUsers(ctx context.Context, query string, limit int) ([]models.UserSearchResult, error) {
+	start := time.Now()
+	results, err := DB.Ops.SearchUsers(ctx, query, limit)
+	return results, DB.observe("SearchUsers", start, err)
+}
+
+// DeleteUser deletes an existing user
+func (DB InstrumentedOps) DeleteUser(ctx context.Context, email string) error {
+	start := time.Now()
+	return DB.observe("DeleteUser", start, DB.Ops.DeleteUser(ctx, email))
+}
+
+// DeleteUserByID deletes an existing user according to its ID
+func (DB InstrumentedOps) DeleteUserByID(ctx context.Context, id string, version int64) error {
+	start := time.Now()
+	return DB.observe("DeleteUserByID", start, DB.Ops.DeleteUserByID(ctx, id, version))
+}
+
+// InsertNewUser inserts a new user
+func (DB InstrumentedOps) InsertNewUser(ctx context.Context, user models.User) error {
+	start := time.Now()
+	return DB.observe("InsertNewUser", start, DB.Ops.InsertNewUser(ctx, user))
+}
+
+// UpdateNameAndPassUser updates the name and pass of an existing user
+func (DB InstrumentedOps) UpdateNameAndPassUser(ctx context.Context, user models.User) error {
+	start := time.Now()
+	return DB.observe("UpdateNameAndPassUser", start, DB.Ops.UpdateNameAndPassUser(ctx, user))
+}
+
+// PatchUser updates only the fields of the patch
+func (DB InstrumentedOps) PatchUser(ctx context.Context, id string, patch models.UserPatch) error {
+	start := time.Now()
+	return DB.observe("PatchUser", start, DB.Ops.PatchUser(ctx, id, patch))
+}
+
+// IsExistsInUsersTable gets the user according to its email
+func (DB InstrumentedOps) IsExistsInUsersTable(ctx context.Context, email string) (*models.User, error) {
+	start := time.Now()
+	user, err := DB.Ops.IsExistsInUsersTable(ctx, email)
+	return user, DB.observe("IsExistsInUsersTable", start, err)
+}
+
+// GetUserByID gets the user according to its ID
+func (DB InstrumentedOps) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	start := time.Now()
+	user, err := DB.Ops.GetUserByID(ctx, id)
+	return user, DB.observe("GetUserByID", start, err)
+}
+
+// ChangeEmail changes the email of the user
+func (DB InstrumentedOps) ChangeEmail(ctx context.Context, id, email string, version int64) error {
+	start := time.Now()
+	return DB.observe("ChangeEmail", start, DB.Ops.ChangeEmail(ctx, id, email, version))
+}
+
+// GetUserAudit gets the audit entries of the user
+func (DB InstrumentedOps) GetUserAudit(ctx context.Context, id string) ([]models.AuditEntry, error) {
+	start := time.Now()
+	entries, err := DB.Ops.GetUserAudit(ctx, id)
+	return entries, DB.observe("GetUserAudit", start, err)
+}
+
+// GrantRole grants the role to the user
+func (DB InstrumentedOps) GrantRole(ctx context.Context, email, role string) error {
+	start := time.Now()
+	return DB.observe("GrantRole", start, DB.Ops.GrantRole(ctx, email, role))
+}
+
+// RevokeRole revokes the role of the user
+func (DB InstrumentedOps) RevokeRole(ctx context.Context, email, role string) error {
+	start := time.Now()
+	return DB.observe("RevokeRole", start, DB.Ops.RevokeRole(ctx, email, role))
+}
+
+// GetRolesPermissions gets the permissions granted by the roles
+func (DB InstrumentedOps) GetRolesPermissions(ctx context.Context, roles []string) ([]string, error) {
+	start := time.Now()
+	permissions, err := DB.Ops.GetRolesPermissions(ctx, roles)
+	return permissions, DB.observe("GetRolesPermissions", start, err)
+}
+
+// InsertRefreshToken inserts a new refresh token
+func (DB InstrumentedOps) InsertRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	start := time.Now()
+	return DB.observe("InsertRefreshToken", start, DB.Ops.InsertRefreshToken(ctx, token))
+}
+
+// GetRefreshToken gets the refresh token according to its hash
+func (DB InstrumentedOps) GetRefreshToken(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	start := time.Now()
+	token, err := DB.Ops.GetRefreshToken(ctx, hash)
+	return token, DB.observe("GetRefreshToken", start, err)
+}
+
+// RevokeRefreshToken revokes the active refresh token
+func (DB InstrumentedOps) RevokeRefreshToken(ctx context.Context, hash string) error {
+	start := time.Now()
+	return DB.observe("RevokeRefreshToken", start, DB.Ops.RevokeRefreshToken(ctx, hash))
+}
+
+// RevokeUserRefreshTokens revokes all the refresh tokens of the user
+func (DB InstrumentedOps) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	start := time.Now()
+	return DB.observe("RevokeUserRefreshTokens", start, DB.Ops.RevokeUserRefreshTokens(ctx, userID))
+}
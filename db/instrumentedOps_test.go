@@ -0,0 +1,32 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gin_CRUD_server/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrumentedOps(t *testing.T) {
+	mapDB := NewTestMapOps("Map DB Instrumented Test")
+	observed := map[string]error{}
+	ops := NewInstrumentedOps(mapDB, func(operation string, duration time.Duration, err error) {
+		assert.True(t, duration >= 0)
+		observed[operation] = err
+	})
+	user := models.NewUser("bari@gmail.com", "bari", "1234")
+	assert.NoError(t, ops.InsertNewUser(context.Background(), *user))
+	_, err := ops.IsExistsInUsersTable(context.Background(), user.Email)
+	assert.NoError(t, err)
+	err = ops.InsertNewUser(context.Background(), *user)
+	assert.ErrorIs(t, err, models.ErrAlreadyExists)
+
+	assert.ErrorIs(t, observed["InsertNewUser"], models.ErrAlreadyExists)
+	assert.Contains(t, observed, "IsExistsInUsersTable")
+	assert.NoError(t, observed["IsExistsInUsersTable"])
+	assert.Equal(t, mapDB, Unwrap(NewInstrumentedOps(ops, ops.Observer)))
+	_, ok := Unwrap(ops).(HealthChecker)
+	assert.True(t, ok)
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gin_CRUD_server/models"
+)
+
+const ListUsersQuery = `SELECT ` + userColumns + ` FROM users u`
+
+// sortColumns are compared byte-wise (the "C" collation) and the username case-insensitively,
+// the same order as models.User.SortValue
+var sortColumns = map[string]string{
+	models.SortByEmail:     `u.email COLLATE "C"`,
+	models.SortByUsername:  `lower(u.username) COLLATE "C"`,
+	models.SortByCreatedAt: `u.sys_created_date`,
+}
+
+const tieBreakerColumn = `u.email COLLATE "C"`
+
+// ListUsers gets a page of the users according to the sorting and filtering options,
+// the page starts after the cursor (keyset pagination) so deep pages stay cheap
+func (DB SqlOps) ListUsers(ctx context.Context, opts models.ListUsersOptions) (*models.UsersPage, error) {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
+	page := &models.UsersPage{Users: []models.User{}}
+	query, args, err := buildListUsersQuery(opts)
+	if err != nil {
+		return page, translateError(err)
+	}
+	rows, err := traced(DB.Db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return page, translateError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return page, translateError(err)
+		}
+		page.Users = append(page.Users, *user)
+	}
+	if err = rows.Err(); err != nil {
+		return page, translateError(err)
+	}
+	// One more user than the limit is fetched to know whether there is a next page
+	if len(page.Users) > opts.Limit {
+		page.Users = page.Users[:opts.Limit]
+		page.NextCursor = opts.Cursor(page.Users[opts.Limit-1])
+	}
+	return page, nil
+}
+
+// buildListUsersQuery returns the query and its arguments according to the options
+func buildListUsersQuery(opts models.ListUsersOptions) (string, []interface{}, error) {
+	column, ok := sortColumns[opts.SortBy]
+	if !ok {
+		return "", nil, models.NewError(models.CodeInvalidRequest, "cannot sort users by %q", opts.SortBy)
+	}
+	if opts.Limit < 1 {
+		return "", nil, models.NewError(models.CodeInvalidValue, "the limit must be at least 1, not %d", opts.Limit)
+	}
+	cursor, err := opts.DecodeCursor()
+	if err != nil {
+		return "", nil, err
+	}
+	var where []string
+	var args []interface{}
+	arg := func(val interface{}) string {
+		args = append(args, val)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if opts.NameContains != "" {
+		where = append(where, `u.username ILIKE `+arg("%"+escapeLike(opts.NameContains)+"%")+` ESCAPE '\'`)
+	}
+	if opts.CreatedBefore != nil {
+		where = append(where, "u.sys_created_date < "+arg(*opts.CreatedBefore))
+	}
+	if opts.CreatedAfter != nil {
+		where = append(where, "u.sys_created_date > "+arg(*opts.CreatedAfter))
+	}
+	direction, operator := "ASC", ">"
+	if opts.Desc {
+		direction, operator = "DESC", "<"
+	}
+	if cursor != nil {
+		value := arg(cursor.Value)
+		if opts.SortBy == models.SortByCreatedAt {
+			value += "::timestamptz"
+		}
+		where = append(where, fmt.Sprintf("(%s, %s) %s (%s, %s)", column, tieBreakerColumn, operator, value, arg(cursor.Email)))
+	}
+
+	query := ListUsersQuery
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, %s %s LIMIT %s", column, direction, tieBreakerColumn, direction, arg(opts.Limit+1))
+	return query, args, nil
+}
+
+// escapeLike escapes the LIKE wildcards so the value is matched literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
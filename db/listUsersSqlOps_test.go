@@ -0,0 +1,42 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"gin_CRUD_server/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_buildListUsersQuery(t *testing.T) {
+	date := time.Date(2022, 7, 23, 0, 0, 0, 0, time.UTC)
+	firstPage := models.NewListUsersOptions()
+	afterUser := models.ListUsersOptions{Limit: 10, SortBy: models.SortByCreatedAt, NameContains: "50%_off", CreatedBefore: &date}
+	afterUser.After = afterUser.Cursor(models.User{Email: "bari@gmail.com", CreatedAt: "2022-07-22T10:00:00Z"})
+
+	tests := []struct {
+		name      string
+		opts      models.ListUsersOptions
+		wantQuery string
+		wantArgs  []interface{}
+		wantErr   bool
+	}{
+		{"Builds the first page query", firstPage,
+			ListUsersQuery + ` ORDER BY u.email COLLATE "C" DESC, u.email COLLATE "C" DESC LIMIT $1`,
+			[]interface{}{models.DefaultListLimit + 1}, false},
+		{"Builds the filtered query after the cursor", afterUser,
+			ListUsersQuery + ` WHERE u.username ILIKE $1 ESCAPE '\' AND u.sys_created_date < $2 AND (u.sys_created_date, u.email COLLATE "C") > ($3::timestamptz, $4)` +
+				` ORDER BY u.sys_created_date ASC, u.email COLLATE "C" ASC LIMIT $5`,
+			[]interface{}{`%50\%\_off%`, date, "2022-07-22T10:00:00Z", "bari@gmail.com", 11}, false},
+		{"Fails due to unknown sort field", models.ListUsersOptions{Limit: 1, SortBy: "password"}, "", nil, true},
+		{"Fails due to cursor of another sort", models.ListUsersOptions{Limit: 1, SortBy: models.SortByEmail, After: afterUser.After}, "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args, err := buildListUsersQuery(tt.opts)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantQuery, query)
+			assert.Equal(t, tt.wantArgs, args)
+		})
+	}
+}
@@ -0,0 +1,2 @@
+-- Passwords are stored as encoded argon2id/bcrypt hashes instead of plaintext
+ALTER TABLE users ALTER COLUMN password TYPE VARCHAR(255);
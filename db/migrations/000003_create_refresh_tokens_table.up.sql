@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens(
+    token_hash       CHAR(64) PRIMARY KEY,
+    email            VARCHAR(200) NOT NULL REFERENCES users(email) ON DELETE CASCADE ON UPDATE CASCADE,
+    expires_at       TIMESTAMP with time zone NOT NULL,
+    revoked_at       TIMESTAMP with time zone,
+    sys_created_date TIMESTAMP with time zone NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS refresh_tokens_email_idx ON refresh_tokens(email);
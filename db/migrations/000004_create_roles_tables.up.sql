@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS roles(
+    name             VARCHAR(50) PRIMARY KEY
+);
+CREATE TABLE IF NOT EXISTS permissions(
+    name             VARCHAR(50) PRIMARY KEY
+);
+CREATE TABLE IF NOT EXISTS role_permissions(
+    role             VARCHAR(50) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission       VARCHAR(50) NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+    PRIMARY KEY (role, permission)
+);
+CREATE TABLE IF NOT EXISTS user_roles(
+    email            VARCHAR(200) NOT NULL REFERENCES users(email) ON DELETE CASCADE ON UPDATE CASCADE,
+    role             VARCHAR(50) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    sys_created_date TIMESTAMP with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (email, role)
+);
+
+INSERT INTO roles (name) VALUES ('admin'), ('support'), ('member') ON CONFLICT DO NOTHING;
+INSERT INTO permissions (name) VALUES
+    ('users.read'), ('users.list'), ('users.update'), ('users.delete'), ('roles.manage')
+ON CONFLICT DO NOTHING;
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'users.read'), ('admin', 'users.list'), ('admin', 'users.update'), ('admin', 'users.delete'), ('admin', 'roles.manage'),
+    ('support', 'users.read'), ('support', 'users.list')
+ON CONFLICT DO NOTHING;
+
+-- Existing users become members
+INSERT INTO user_roles (email, role) SELECT email, 'member' FROM users ON CONFLICT DO NOTHING;
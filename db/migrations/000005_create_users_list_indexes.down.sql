@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_created_idx;
+DROP INDEX IF EXISTS users_username_idx;
+DROP INDEX IF EXISTS users_email_c_idx;
@@ -0,0 +1,4 @@
+-- Indexes for the keyset pagination of GET /users (see db/listUsersSqlOps.go)
+CREATE INDEX IF NOT EXISTS users_email_c_idx ON users (email COLLATE "C");
+CREATE INDEX IF NOT EXISTS users_username_idx ON users (lower(username) COLLATE "C", email COLLATE "C");
+CREATE INDEX IF NOT EXISTS users_created_idx ON users (sys_created_date, email COLLATE "C");
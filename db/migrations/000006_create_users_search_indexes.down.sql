@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS users_username_trgm_idx;
+DROP INDEX IF EXISTS users_email_trgm_idx;
+DROP INDEX IF EXISTS users_search_vector_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,12 @@
+-- Full-text (tsvector) and fuzzy (pg_trgm) search of GET /users/search (see db/searchSqlOps.go)
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- The email is split into words so that "bari" or "gmail" match bari@gmail.com
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', coalesce(username, '')), 'A') ||
+    setweight(to_tsvector('simple', regexp_replace(email, '[^[:alnum:]]+', ' ', 'g')), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS users_search_vector_idx ON users USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS users_email_trgm_idx ON users USING GIN (lower(email) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_username_trgm_idx ON users USING GIN (lower(username) gin_trgm_ops);
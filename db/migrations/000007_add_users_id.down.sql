@@ -0,0 +1,21 @@
+ALTER TABLE user_roles ADD COLUMN IF NOT EXISTS email VARCHAR(200);
+UPDATE user_roles r SET email = u.email FROM users u WHERE u.id = r.user_id;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS email VARCHAR(200);
+UPDATE refresh_tokens t SET email = u.email FROM users u WHERE u.id = t.user_id;
+DROP INDEX IF EXISTS refresh_tokens_user_id_idx;
+ALTER TABLE user_roles DROP COLUMN IF EXISTS user_id;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS user_id;
+
+DROP INDEX IF EXISTS users_email_lower_idx;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_pkey;
+ALTER TABLE users DROP COLUMN IF EXISTS id;
+ALTER TABLE users ADD PRIMARY KEY (email);
+
+ALTER TABLE user_roles ALTER COLUMN email SET NOT NULL;
+ALTER TABLE user_roles ADD FOREIGN KEY (email) REFERENCES users(email) ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE user_roles ADD PRIMARY KEY (email, role);
+ALTER TABLE refresh_tokens ALTER COLUMN email SET NOT NULL;
+ALTER TABLE refresh_tokens ADD FOREIGN KEY (email) REFERENCES users(email) ON DELETE CASCADE ON UPDATE CASCADE;
+CREATE INDEX IF NOT EXISTS refresh_tokens_email_idx ON refresh_tokens(email);
+
+DROP FUNCTION IF EXISTS uuid_generate_v7(TIMESTAMP with time zone);
@@ -0,0 +1,37 @@
+-- UUIDv7 (RFC 9562): 48 bits of unix milliseconds followed by random bits
+CREATE OR REPLACE FUNCTION uuid_generate_v7(ts TIMESTAMP with time zone DEFAULT clock_timestamp()) RETURNS UUID AS $$
+    SELECT encode(
+        set_bit(set_bit(
+            overlay(uuid_send(gen_random_uuid())
+                placing substring(int8send(floor(extract(epoch FROM ts) * 1000)::BIGINT) FROM 3)
+                FROM 1 FOR 6),
+            52, 1), 53, 1),
+        'hex')::UUID;
+$$ LANGUAGE SQL VOLATILE;
+
+-- Existing users get an ID ordered by their creation date
+ALTER TABLE users ADD COLUMN IF NOT EXISTS id UUID;
+UPDATE users SET id = uuid_generate_v7(sys_created_date) WHERE id IS NULL;
+ALTER TABLE users ALTER COLUMN id SET NOT NULL;
+ALTER TABLE users ALTER COLUMN id SET DEFAULT uuid_generate_v7();
+
+-- The user_roles & refresh_tokens tables reference the ID instead of the email
+ALTER TABLE user_roles ADD COLUMN IF NOT EXISTS user_id UUID;
+UPDATE user_roles r SET user_id = u.id FROM users u WHERE u.email = r.email;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS user_id UUID;
+UPDATE refresh_tokens t SET user_id = u.id FROM users u WHERE u.email = t.email;
+ALTER TABLE user_roles DROP CONSTRAINT IF EXISTS user_roles_pkey;
+ALTER TABLE user_roles DROP COLUMN IF EXISTS email;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS email;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_pkey;
+ALTER TABLE users ADD PRIMARY KEY (id);
+-- The emails are unique regardless of their case
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_idx ON users (lower(email));
+
+ALTER TABLE user_roles ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE user_roles ADD FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE user_roles ADD PRIMARY KEY (user_id, role);
+ALTER TABLE refresh_tokens ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE refresh_tokens ADD FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_id_idx ON refresh_tokens(user_id);
@@ -0,0 +1,6 @@
+-- Every change of a user increments its version, the version is the ETag of the user
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP with time zone;
+UPDATE users SET updated_at = sys_created_date WHERE updated_at IS NULL;
+ALTER TABLE users ALTER COLUMN updated_at SET NOT NULL;
+ALTER TABLE users ALTER COLUMN updated_at SET DEFAULT now();
@@ -0,0 +1,2 @@
+INSERT INTO permissions (name) VALUES ('db.stats') ON CONFLICT DO NOTHING;
+INSERT INTO role_permissions (role, permission) VALUES ('admin', 'db.stats') ON CONFLICT DO NOTHING;
@@ -0,0 +1,8 @@
+-- Records the version of the last applied migration like golang-migrate, the migrations applied
+-- by the docker-entrypoint-initdb.d scripts or psql set it themselves
+CREATE TABLE IF NOT EXISTS schema_migrations(
+    version          BIGINT NOT NULL PRIMARY KEY,
+    dirty            BOOLEAN NOT NULL
+);
+DELETE FROM schema_migrations;
+INSERT INTO schema_migrations (version, dirty) VALUES (10, false);
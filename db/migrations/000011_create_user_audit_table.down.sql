@@ -0,0 +1,5 @@
+DELETE FROM role_permissions WHERE permission = 'users.audit';
+DELETE FROM permissions WHERE name = 'users.audit';
+DROP TABLE IF EXISTS user_audit;
+DROP FUNCTION IF EXISTS user_audit_append_only();
+UPDATE schema_migrations SET version=10;
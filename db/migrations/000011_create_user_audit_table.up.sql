@@ -0,0 +1,31 @@
+-- The audit entries of the changes of the users, written in the transaction of each change. The entries
+-- reference the user ID without a foreign key so they are kept when the user is deleted
+CREATE TABLE IF NOT EXISTS user_audit(
+    id               BIGSERIAL PRIMARY KEY,
+    user_id          UUID NOT NULL,
+    action           VARCHAR(16) NOT NULL CHECK (action IN ('create', 'update', 'delete')),
+    actor_id         UUID,
+    changes          JSONB NOT NULL,
+    client_ip        VARCHAR(64),
+    request_id       VARCHAR(128),
+    created_at       TIMESTAMP with time zone NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS user_audit_user_id_idx ON user_audit (user_id, id);
+
+-- The entries are append-only, updating, deleting or truncating them fails
+CREATE OR REPLACE FUNCTION user_audit_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'the user_audit entries cannot be changed';
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS user_audit_append_only ON user_audit;
+CREATE TRIGGER user_audit_append_only BEFORE UPDATE OR DELETE ON user_audit
+    FOR EACH ROW EXECUTE FUNCTION user_audit_append_only();
+DROP TRIGGER IF EXISTS user_audit_no_truncate ON user_audit;
+CREATE TRIGGER user_audit_no_truncate BEFORE TRUNCATE ON user_audit
+    FOR EACH STATEMENT EXECUTE FUNCTION user_audit_append_only();
+
+INSERT INTO permissions (name) VALUES ('users.audit') ON CONFLICT DO NOTHING;
+INSERT INTO role_permissions (role, permission) VALUES ('admin', 'users.audit') ON CONFLICT DO NOTHING;
+
+UPDATE schema_migrations SET version=11;
@@ -0,0 +1,49 @@
+package db
+
+import "database/sql"
+
+// PoolStats are the statistics of the connection pool of the DB
+type PoolStats struct {
+	MaxOpenConnections  int     `json:"max_open_connections"`
+	OpenConnections     int     `json:"open_connections"`
+	InUse               int     `json:"in_use"`
+	Idle                int     `json:"idle"`
+	WaitCount           int64   `json:"wait_count"`
+	WaitDurationSeconds float64 `json:"wait_duration_seconds"`
+	MaxIdleClosed       int64   `json:"max_idle_closed"`
+	MaxIdleTimeClosed   int64   `json:"max_idle_time_closed"`
+	MaxLifetimeClosed   int64   `json:"max_lifetime_closed"`
+}
+
+// PoolStatsProvider is implemented by the DB operations using a connection pool
+type PoolStatsProvider interface {
+	PoolStats() PoolStats
+}
+
+// NewPoolStats returns the pool statistics of the sql.DBStats
+func NewPoolStats(stats sql.DBStats) PoolStats {
+	return PoolStats{
+		MaxOpenConnections:  stats.MaxOpenConnections,
+		OpenConnections:     stats.OpenConnections,
+		InUse:               stats.InUse,
+		Idle:                stats.Idle,
+		WaitCount:           stats.WaitCount,
+		WaitDurationSeconds: stats.WaitDuration.Seconds(),
+		MaxIdleClosed:       stats.MaxIdleClosed,
+		MaxIdleTimeClosed:   stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:   stats.MaxLifetimeClosed,
+	}
+}
+
+// PoolStats returns the statistics of the connection pool
+func (DB SqlOps) PoolStats() PoolStats {
+	return NewPoolStats(DB.Db.Stats())
+}
+
+// configurePool applies the pool settings of the config to the DB
+func configurePool(db *sql.DB, config *Config) {
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"gin_CRUD_server/models"
+)
+
+const (
+	InsertRefreshTokenQuery      = `INSERT INTO refresh_tokens ("token_hash", "user_id", "expires_at") VALUES ($1, $2, $3)`
+	GetRefreshTokenQuery         = `SELECT token_hash, user_id, expires_at, revoked_at, sys_created_date FROM refresh_tokens WHERE token_hash=$1`
+	RevokeRefreshTokenQuery      = `UPDATE refresh_tokens SET revoked_at=now() WHERE token_hash=$1 AND revoked_at IS NULL`
+	RevokeUserRefreshTokensQuery = `UPDATE refresh_tokens SET revoked_at=now() WHERE user_id=$1 AND revoked_at IS NULL`
+)
+
+// InsertRefreshToken inserts a new refresh token into the refresh_tokens table
+func (DB SqlOps) InsertRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
+	if _, err := traced(DB.Db).ExecContext(ctx, InsertRefreshTokenQuery, token.Hash, token.UserID, token.ExpiresAt); err != nil {
+		return translateError(err)
+	}
+	return nil
+}
+
+// GetRefreshToken gets the refresh token according to its hash
+func (DB SqlOps) GetRefreshToken(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
+	var token models.RefreshToken
+	var revokedAt sql.NullTime
+	row := traced(DB.Db).QueryRowContext(ctx, GetRefreshTokenQuery, hash)
+	if err := row.Scan(&token.Hash, &token.UserID, &token.ExpiresAt, &revokedAt, &token.CreatedAt); err == sql.ErrNoRows {
+		return &token, models.ErrRefreshTokenNotFound
+	} else if err != nil {
+		return &token, translateError(err)
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return &token, nil
+}
+
+// RevokeRefreshToken revokes an active refresh token, it returns ErrRefreshTokenNotFound if the
+// token doesn't exist or was already revoked so that a token can be rotated only once
+func (DB SqlOps) RevokeRefreshToken(ctx context.Context, hash string) error {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
+	result, err := traced(DB.Db).ExecContext(ctx, RevokeRefreshTokenQuery, hash)
+	if err != nil {
+		return translateError(err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return translateError(err)
+	} else if rows == 0 {
+		return models.ErrRefreshTokenNotFound
+	}
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes all the active refresh tokens of the user
+func (DB SqlOps) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
+	if _, err := traced(DB.Db).ExecContext(ctx, RevokeUserRefreshTokensQuery, userID); err != nil {
+		return translateError(err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+
+	"gin_CRUD_server/models"
+	"github.com/lib/pq"
+)
+
+const (
+	GrantRoleQuery           = `INSERT INTO user_roles ("user_id", "role") SELECT id, $2 FROM users WHERE lower(email)=lower($1) ON CONFLICT DO NOTHING`
+	RevokeRoleQuery          = `DELETE FROM user_roles WHERE user_id=(SELECT id FROM users WHERE lower(email)=lower($1)) AND role=$2`
+	GetRolesPermissionsQuery = `SELECT DISTINCT permission FROM role_permissions WHERE role = ANY($1) ORDER BY permission`
+)
+
+// GrantRole grants the role to an existing user, granting a role twice is not an error
+func (DB SqlOps) GrantRole(ctx context.Context, email, role string) error {
+	return DB.changeRole(ctx, GrantRoleQuery, email, role, nil)
+}
+
+// RevokeRole revokes the role of the user, it returns ErrRoleNotGranted if the user doesn't have the role
+func (DB SqlOps) RevokeRole(ctx context.Context, email, role string) error {
+	return DB.changeRole(ctx, RevokeRoleQuery, email, role, models.ErrRoleNotGranted)
+}
+
+// changeRole grants or revokes the role of the user locked by its email according to the query, it
+// returns unchanged when the roles of the user are unchanged. A change increments the version of the
+// user and records its audit entry in the same transaction
+func (DB SqlOps) changeRole(ctx context.Context, query, email, role string, unchanged error) error {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
+	tx, err := DB.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return translateError(err)
+	}
+	defer tx.Rollback()
+	before, err := scanUser(traced(tx).QueryRowContext(ctx, LockUserQuery, email))
+	if err != nil {
+		return err
+	}
+	result, err := traced(tx).ExecContext(ctx, query, email, role)
+	if err != nil {
+		return translateError(err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return translateError(err)
+	} else if rows == 0 {
+		return unchanged
+	}
+	if _, err = traced(tx).ExecContext(ctx, TouchUserQuery, email); err != nil {
+		return translateError(err)
+	}
+	after, err := scanUser(traced(tx).QueryRowContext(ctx, GetUserByIDQuery, before.ID))
+	if err != nil {
+		return err
+	}
+	if err = insertAuditEntry(ctx, traced(tx), models.NewAuditEntry(ctx, models.AuditUpdate, before, after)); err != nil {
+		return err
+	}
+	return translateError(tx.Commit())
+}
+
+// GetRolesPermissions gets the permissions granted by the roles
+func (DB SqlOps) GetRolesPermissions(ctx context.Context, roles []string) ([]string, error) {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
+	permissions := []string{}
+	rows, err := traced(DB.Db).QueryContext(ctx, GetRolesPermissionsQuery, pq.Array(roles))
+	if err != nil {
+		return permissions, translateError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var permission string
+		if err = rows.Scan(&permission); err != nil {
+			return permissions, translateError(err)
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, translateError(rows.Err())
+}
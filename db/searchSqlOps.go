@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"strings"
+
+	"gin_CRUD_server/models"
+)
+
+// SearchUsersQuery matches the prefixes of the words ($1) using the tsvector index, or similar
+// emails & usernames ($2) using the trigram indexes, the rank combines both scores
+const SearchUsersQuery = `SELECT ` + userColumns + `,
+	ts_rank(u.search_vector, to_tsquery('simple', $1)) + greatest(similarity(lower(u.email), $2), similarity(lower(u.username), $2)) AS rank
+	FROM users u
+	WHERE u.search_vector @@ to_tsquery('simple', $1) OR lower(u.email) % $2 OR lower(u.username) % $2
+	ORDER BY rank DESC, u.email COLLATE "C" ASC LIMIT $3`
+
+// SearchUsers gets the users matching the search query ranked by relevance
+func (DB SqlOps) SearchUsers(ctx context.Context, query string, limit int) ([]models.UserSearchResult, error) {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
+	results := []models.UserSearchResult{}
+	terms := models.SearchTerms(query)
+	if len(terms) == 0 {
+		return results, nil
+	}
+	rows, err := traced(DB.Db).QueryContext(ctx, SearchUsersQuery, prefixTsQuery(terms), strings.Join(terms, " "), limit)
+	if err != nil {
+		return results, translateError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rank float64
+		user, err := scanUser(rows, &rank)
+		if err != nil {
+			return results, translateError(err)
+		}
+		results = append(results, models.NewUserSearchResult(*user, rank, terms))
+	}
+	return results, translateError(rows.Err())
+}
+
+// prefixTsQuery returns the tsquery matching all the terms as word prefixes ("bari:* & gm:*"),
+// the terms contain only letters & digits so they can't inject tsquery operators
+func prefixTsQuery(terms []string) string {
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = term + ":*"
+	}
+	return strings.Join(prefixes, " & ")
+}
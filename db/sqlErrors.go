@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+
+	"gin_CRUD_server/models"
+	"github.com/lib/pq"
+)
+
+// The PostgreSQL error codes translated into the models errors
+const (
+	uniqueViolation           = "23505"
+	foreignKeyViolation       = "23503"
+	notNullViolation          = "23502"
+	checkViolation            = "23514"
+	stringDataRightTruncation = "22001"
+	invalidTextRepresentation = "22P02"
+	serializationFailure      = "40001"
+	deadlockDetected          = "40P01"
+	queryCanceled             = "57014"
+	adminShutdown             = "57P01"
+	cannotConnectNow          = "57P03"
+	tooManyConnections        = "53300"
+
+	// connectionExceptionClass is the class of the errors of the connection to the DB
+	connectionExceptionClass = "08"
+
+	usersEmailConstraint    = "users_email_lower_idx"
+	userRolesRoleConstraint = "user_roles_role_fkey"
+	userIDConstraintSuffix  = "user_id_fkey"
+)
+
+// translateError translates the pq and context errors into the models error of the same kind,
+// so that the handlers don't depend on the driver and the SQL and map DBs return the same errors
+func translateError(err error) error {
+	var modelsErr *models.Error
+	if err == nil || errors.As(err, &modelsErr) {
+		return err
+	}
+	if ctxErr := contextError(err); ctxErr != nil {
+		return ctxErr
+	}
+	var netErr net.Error
+	if errors.Is(err, sql.ErrConnDone) || errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr) {
+		return unavailable.Wrap(err)
+	}
+	pqErr, ok := err.(*pq.Error)
+	if !ok {
+		return err
+	}
+	if pqErr.Code.Class() == connectionExceptionClass {
+		return unavailable.Wrap(err)
+	}
+	switch pqErr.Code {
+	case uniqueViolation:
+		if pqErr.Constraint == usersEmailConstraint {
+			return models.ErrEmailTaken.Wrap(err)
+		}
+		return models.NewError(models.CodeAlreadyExists, "the %s already exists", singular(pqErr.Table)).Wrap(err)
+	case foreignKeyViolation:
+		if pqErr.Constraint == userRolesRoleConstraint {
+			return models.NewError(models.CodeRoleNotFound, "the role doesn't exist").Wrap(err)
+		}
+		if strings.HasSuffix(pqErr.Constraint, userIDConstraintSuffix) {
+			return models.ErrUserNotFound.Wrap(err)
+		}
+		return models.NewError(models.CodeInvalidValue, "a referenced value doesn't exist").Wrap(err)
+	case notNullViolation, checkViolation, stringDataRightTruncation, invalidTextRepresentation:
+		return invalidValue(pqErr.Column, "the "+pqErr.Column+" is invalid").Wrap(err)
+	case serializationFailure, deadlockDetected:
+		return models.NewError(models.CodeConflict, "the operation conflicted with another request, please try again").Wrap(err)
+	case queryCanceled:
+		return timeout.Wrap(err)
+	case adminShutdown, cannotConnectNow, tooManyConnections:
+		return unavailable.Wrap(err)
+	}
+	return err
+}
+
+var (
+	timeout     = models.NewError(models.CodeTimeout, "the operation timed out, please try again later")
+	unavailable = models.NewError(models.CodeUnavailable, "the DB is unavailable, please try again later")
+	canceled    = models.NewError(models.CodeUnavailable, "the operation was canceled")
+)
+
+// contextError returns the models error of the context error: ErrTimeout after the deadline
+// of the context, or ErrUnavailable when it was canceled (the client went away)
+func contextError(err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return timeout.Wrap(err)
+	case errors.Is(err, context.Canceled):
+		return canceled.Wrap(err)
+	}
+	return nil
+}
+
+// checkContext returns the models error of the context when it is done, so the map DB stops
+// like the SQL DB
+func checkContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return contextError(err)
+	}
+	return nil
+}
+
+// singular returns the singular name of the table
+func singular(table string) string {
+	return strings.ReplaceAll(strings.TrimSuffix(table, "s"), "_", " ")
+}
+
+// invalidValue returns the error of the invalid value of the column, without the field
+// when the column is unknown
+func invalidValue(column, message string) *models.Error {
+	invalid := models.NewError(models.CodeInvalidValue, "a value is invalid or too long")
+	if column != "" {
+		invalid.Fields = []models.FieldError{{Field: column, Code: models.CodeFieldInvalid, Message: message}}
+	}
+	return invalid
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"gin_CRUD_server/models"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_translateError(t *testing.T) {
+	other := errors.New("connection refused")
+	tests := []struct {
+		name      string
+		err       error
+		wantCode  string
+		wantKind  error
+		wantField string
+	}{
+		{"Translates the unique email", &pq.Error{Code: uniqueViolation, Constraint: usersEmailConstraint}, models.CodeEmailTaken, models.ErrAlreadyExists, ""},
+		{"Translates another unique violation", &pq.Error{Code: uniqueViolation, Table: "refresh_tokens", Constraint: "refresh_tokens_pkey"}, models.CodeAlreadyExists, models.ErrAlreadyExists, ""},
+		{"Translates the unknown role", &pq.Error{Code: foreignKeyViolation, Constraint: userRolesRoleConstraint}, models.CodeRoleNotFound, models.ErrInvalid, ""},
+		{"Translates the unknown user", &pq.Error{Code: foreignKeyViolation, Constraint: "refresh_tokens_user_id_fkey"}, models.CodeUserNotFound, models.ErrNotFound, ""},
+		{"Translates the too long value", &pq.Error{Code: stringDataRightTruncation}, models.CodeInvalidValue, models.ErrInvalid, ""},
+		{"Translates the null value of the column", &pq.Error{Code: notNullViolation, Column: "username"}, models.CodeInvalidValue, models.ErrInvalid, "username"},
+		{"Translates the serialization failure", &pq.Error{Code: serializationFailure}, models.CodeConflict, models.ErrConflict, ""},
+		{"Translates the statement timeout", &pq.Error{Code: queryCanceled}, models.CodeTimeout, models.ErrTimeout, ""},
+		{"Translates the too many connections", &pq.Error{Code: tooManyConnections}, models.CodeUnavailable, models.ErrUnavailable, ""},
+		{"Translates the connection failure", &pq.Error{Code: "08006"}, models.CodeUnavailable, models.ErrUnavailable, ""},
+		{"Translates the exceeded deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), models.CodeTimeout, models.ErrTimeout, ""},
+		{"Translates the canceled context", context.Canceled, models.CodeUnavailable, models.ErrUnavailable, ""},
+		{"Translates the closed connection", sql.ErrConnDone, models.CodeUnavailable, models.ErrUnavailable, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := translateError(tt.err)
+			var e *models.Error
+			if assert.ErrorAs(t, err, &e) {
+				assert.Equal(t, tt.wantCode, e.Code)
+				assert.ErrorIs(t, err, tt.wantKind)
+				assert.ErrorIs(t, err, tt.err)
+				if tt.wantField != "" {
+					assert.Equal(t, tt.wantField, e.Fields[0].Field)
+				}
+			}
+		})
+	}
+	t.Run("Keeps the other errors", func(t *testing.T) {
+		assert.Equal(t, other, translateError(other))
+		assert.Nil(t, translateError(nil))
+		assert.Equal(t, error(&pq.Error{Code: "XX000"}), translateError(&pq.Error{Code: "XX000"}))
+		assert.Equal(t, error(models.ErrEmailTaken), translateError(models.ErrEmailTaken))
+	})
+}
+
+func TestTestMapOps_InsertNewUser(t *testing.T) {
+	ctx := context.Background()
+	mapDB := NewTestMapOps("Insert Test")
+	user := models.NewUser("bari@gmail.com", "bari", "1234")
+	assert.NoError(t, mapDB.InsertNewUser(ctx, *user))
+
+	tests := []struct {
+		name     string
+		user     *models.User
+		wantCode string
+		wantKind error
+	}{
+		{"Inserts fail due to the email in another case", models.NewUser("BARI@gmail.com", "bari2", "1234"), models.CodeEmailTaken, models.ErrAlreadyExists},
+		{"Inserts fail due to the existing ID", &models.User{ID: user.ID, Email: "other@gmail.com", Name: "other"}, models.CodeAlreadyExists, models.ErrAlreadyExists},
+		{"Inserts fail due to the too long name", models.NewUser("long@gmail.com", string(make([]byte, 51)), "1234"), models.CodeInvalidValue, models.ErrInvalid},
+		{"Inserts fail due to the missing email", models.NewUser("", "bari", "1234"), models.CodeInvalidValue, models.ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := mapDB.InsertNewUser(ctx, *tt.user)
+			var e *models.Error
+			if assert.ErrorAs(t, err, &e) {
+				assert.Equal(t, tt.wantCode, e.Code)
+				assert.ErrorIs(t, err, tt.wantKind)
+			}
+		})
+	}
+	stored, err := mapDB.IsExistsInUsersTable(ctx, "bari@gmail.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "bari", stored.Name)
+}
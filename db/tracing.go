@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"gin_CRUD_server/models"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation name of the spans of the queries
+const TracerName = "gin_CRUD_server/db"
+
+// QueryNameKey is the attribute of the spans holding the name of the query constant
+const QueryNameKey = attribute.Key("db.query.name")
+
+// ErrorCodeKey is the attribute of the spans holding the SQLSTATE or the error code of the failed query
+const ErrorCodeKey = attribute.Key("db.error.code")
+
+// queryNames are the names of the query constants, they name the spans of the queries so the
+// statements and the values of their parameters aren't traced
+var queryNames = map[string]string{
+	DeleteUserQuery:              "DeleteUserQuery",
+	DeleteUserByIDQuery:          "DeleteUserByIDQuery",
+	IsExistsUserQuery:            "IsExistsUserQuery",
+	GetUserByIDQuery:             "GetUserByIDQuery",
+	LockUserQuery:                "LockUserQuery",
+	LockUserByIDQuery:            "LockUserByIDQuery",
+	GetAllUsersQuery:             "GetAllUsersQuery",
+	UpdateUserQuery:              "UpdateUserQuery",
+	PatchUserQuery:               "PatchUserQuery",
+	ChangeEmailQuery:             "ChangeEmailQuery",
+	TouchUserQuery:               "TouchUserQuery",
+	InsertNewUserQuery:           "InsertNewUserQuery",
+	ListUsersQuery:               "ListUsersQuery",
+	SearchUsersQuery:             "SearchUsersQuery",
+	GrantRoleQuery:               "GrantRoleQuery",
+	RevokeRoleQuery:              "RevokeRoleQuery",
+	GetRolesPermissionsQuery:     "GetRolesPermissionsQuery",
+	InsertRefreshTokenQuery:      "InsertRefreshTokenQuery",
+	GetRefreshTokenQuery:         "GetRefreshTokenQuery",
+	RevokeRefreshTokenQuery:      "RevokeRefreshTokenQuery",
+	RevokeUserRefreshTokensQuery: "RevokeUserRefreshTokensQuery",
+	GetSchemaVersionQuery:        "GetSchemaVersionQuery",
+	InsertAuditEntryQuery:        "InsertAuditEntryQuery",
+	GetUserAuditQuery:            "GetUserAuditQuery",
+}
+
+// queryName returns the name of the query constant, the filters and the sorting of the users list
+// are appended to ListUsersQuery
+func queryName(query string) string {
+	if name, ok := queryNames[query]; ok {
+		return name
+	}
+	if strings.HasPrefix(query, ListUsersQuery) {
+		return queryNames[ListUsersQuery]
+	}
+	return "Query"
+}
+
+// conn is a *sql.DB or *sql.Tx
+type conn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// tracedConn runs the queries of the connection in child spans of the span of the context, the
+// spans are created by the tracer provider of this span so there are none outside of a trace
+type tracedConn struct {
+	conn conn
+}
+
+// traced returns the connection whose queries are traced
+func traced(c conn) tracedConn {
+	return tracedConn{conn: c}
+}
+
+// ExecContext executes the query in a span
+func (c tracedConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	defer span.End()
+	result, err := c.conn.ExecContext(ctx, query, args...)
+	recordQueryError(span, err)
+	return result, err
+}
+
+// QueryContext executes the query in a span, the span ends before the rows are read
+func (c tracedConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	defer span.End()
+	rows, err := c.conn.QueryContext(ctx, query, args...)
+	recordQueryError(span, err)
+	return rows, err
+}
+
+// QueryRowContext executes the query in a span, the span ends before the row is scanned
+func (c tracedConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuerySpan(ctx, query)
+	defer span.End()
+	row := c.conn.QueryRowContext(ctx, query, args...)
+	recordQueryError(span, row.Err())
+	return row
+}
+
+// startQuerySpan starts the client span of the query named by its query constant
+func startQuerySpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := queryName(query)
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(TracerName)
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.DBSystemPostgreSQL,
+		semconv.DBOperationKey.String(strings.ToUpper(strings.Fields(query)[0])),
+		QueryNameKey.String(name),
+	))
+}
+
+// recordQueryError records the error of the query on its span, no rows isn't an error of the query.
+// Only its SQLSTATE or error code is recorded since the messages of the DB errors hold the values
+func recordQueryError(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		code := queryErrorCode(err)
+		span.SetAttributes(ErrorCodeKey.String(code))
+		span.SetStatus(codes.Error, code)
+	}
+}
+
+// queryErrorCode returns the SQLSTATE of the DB error, or the code of the models error
+func queryErrorCode(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code)
+	}
+	var modelsErr *models.Error
+	if errors.As(translateError(err), &modelsErr) {
+		return modelsErr.Code
+	}
+	return models.CodeInternal
+}
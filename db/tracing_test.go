@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gin_CRUD_server/models"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// fakeConn returns the error of each query
+type fakeConn struct {
+	err error
+}
+
+func (c fakeConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, c.err
+}
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, c.err
+}
+
+func (c fakeConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func TestTracedConn(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	errBroken := errors.New("broken connection")
+	tests := []struct {
+		name       string
+		query      func(ctx context.Context, c tracedConn) error
+		err        error
+		wantSpan   string
+		wantStatus codes.Code
+		wantCode   string
+	}{
+		{"Traces the query by its constant name", func(ctx context.Context, c tracedConn) error {
+			_, err := c.ExecContext(ctx, DeleteUserQuery, "bari@gmail.com")
+			return err
+		}, nil, "DeleteUserQuery", codes.Unset, ""},
+		{"Traces the users list by its prefix", func(ctx context.Context, c tracedConn) error {
+			_, err := c.QueryContext(ctx, ListUsersQuery+" WHERE u.username ILIKE $1", "%bari%")
+			return err
+		}, nil, "ListUsersQuery", codes.Unset, ""},
+		{"Traces the error of the query", func(ctx context.Context, c tracedConn) error {
+			_, err := c.QueryContext(ctx, GetRolesPermissionsQuery)
+			return err
+		}, errBroken, "GetRolesPermissionsQuery", codes.Error, models.CodeInternal},
+		{"Traces the SQLSTATE of the DB error without its values", func(ctx context.Context, c tracedConn) error {
+			_, err := c.ExecContext(ctx, InsertNewUserQuery, "1", "bari@gmail.com", "bari", "1234")
+			return err
+		}, &pq.Error{Code: uniqueViolation, Message: "duplicate key", Detail: "Key (email)=(bari@gmail.com) already exists."}, "InsertNewUserQuery", codes.Error, string(uniqueViolation)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+			ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+			err := tt.query(ctx, traced(fakeConn{err: tt.err}))
+			parent.End()
+			assert.ErrorIs(t, err, tt.err)
+			spans := exporter.GetSpans()
+			require.Len(t, spans, 2)
+			assert.Equal(t, tt.wantSpan, spans[0].Name)
+			assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent.SpanID())
+			assert.Equal(t, tt.wantStatus, spans[0].Status.Code)
+			assert.Equal(t, tt.wantCode, spans[0].Status.Description)
+			assert.Empty(t, spans[0].Events, "the error messages must not be traced")
+			for _, attr := range spans[0].Attributes {
+				assert.NotContains(t, attr.Value.Emit(), "bari", "the parameters must not be traced")
+			}
+		})
+	}
+
+	// There are no spans outside of a trace
+	exporter.Reset()
+	_, err := traced(fakeConn{}).ExecContext(context.Background(), DeleteUserQuery, "bari@gmail.com")
+	assert.NoError(t, err)
+	assert.Empty(t, exporter.GetSpans())
+}
+
+func Test_queryNames(t *testing.T) {
+	// Every query constant names its spans
+	files, err := filepath.Glob("*.go")
+	require.NoError(t, err)
+	constants := []string{}
+	for _, file := range files {
+		parsed, err := parser.ParseFile(token.NewFileSet(), file, nil, 0)
+		require.NoError(t, err)
+		for name, object := range parsed.Scope.Objects {
+			if object.Kind == ast.Con && strings.HasSuffix(name, "Query") {
+				constants = append(constants, name)
+			}
+		}
+	}
+	names := []string{}
+	for _, name := range queryNames {
+		names = append(names, name)
+	}
+	assert.ElementsMatch(t, constants, names)
+}
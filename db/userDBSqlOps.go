@@ -1,67 +1,223 @@
 package db
 
 import (
+	"context"
+	"database/sql"
+	"time"
+
 	"gin_CRUD_server/models"
+	"github.com/lib/pq"
 )
 
+// SqlOps are the DB operations of the PostgreSQL DB using its own connection pool, each operation
+// is stopped after the QueryTimeout (no timeout when zero) even if the context of the request has
+// no deadline
 type SqlOps struct {
-	Name string
+	Name         string
+	Db           *sql.DB
+	QueryTimeout time.Duration
+}
+
+// NewSqlOps connects to the DB of the config and returns its DB operations
+func NewSqlOps(ctx context.Context, name string, config *Config) (*SqlOps, error) {
+	conn, err := ConnectToDb(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return &SqlOps{Name: name, Db: conn, QueryTimeout: config.QueryTimeout}, nil
+}
+
+// Close closes the connection pool of the DB
+func (DB SqlOps) Close() error {
+	return DB.Db.Close()
 }
 
 const (
-	DeleteUserQuery    = `DELETE FROM users WHERE email=$1`
-	IsExistsUserQuery  = `SELECT * FROM users WHERE email=$1`
-	GetAllUsersQuery   = `SELECT * FROM users ORDER BY email DESC`
-	UpdateUserQuery    = `UPDATE users SET username=$1, password=$2 WHERE email=$3`
-	InsertNewUserQuery = `INSERT INTO users ("email", "username", "password") VALUES ($1, $2, $3)`
+	DeleteUserQuery     = `DELETE FROM users WHERE lower(email)=lower($1)`
+	DeleteUserByIDQuery = `DELETE FROM users WHERE id=$1 AND ($2::BIGINT=0 OR version=$2)`
+	IsExistsUserQuery   = `SELECT ` + userColumns + ` FROM users u WHERE lower(u.email)=lower($1)`
+	GetUserByIDQuery    = `SELECT ` + userColumns + ` FROM users u WHERE u.id=$1`
+	LockUserQuery       = `SELECT ` + userColumns + ` FROM users u WHERE lower(u.email)=lower($1) FOR UPDATE OF u`
+	LockUserByIDQuery   = `SELECT ` + userColumns + ` FROM users u WHERE u.id=$1 FOR UPDATE OF u`
+	GetAllUsersQuery    = `SELECT ` + userColumns + ` FROM users u ORDER BY u.email DESC`
+	UpdateUserQuery     = `UPDATE users SET username=$1, password=$2, ` + nextVersion + ` WHERE lower(email)=lower($3) AND ($4::BIGINT=0 OR version=$4)`
+	PatchUserQuery      = `UPDATE users SET username=COALESCE($1, username), password=COALESCE($2, password), ` + nextVersion + ` WHERE id=$3 AND ($4::BIGINT=0 OR version=$4)`
+	ChangeEmailQuery    = `UPDATE users SET email=$1, ` + nextVersion + ` WHERE id=$2 AND ($3::BIGINT=0 OR version=$3)`
+	TouchUserQuery      = `UPDATE users SET ` + nextVersion + ` WHERE lower(email)=lower($1)`
+	InsertNewUserQuery  = `INSERT INTO users ("id", "email", "username", "password") VALUES ($1, $2, $3, $4)`
+
+	userColumns     = `u.id, u.email, u.username, u.password, u.sys_created_date, u.updated_at, u.version, ` + userRolesColumn
+	userRolesColumn = `ARRAY(SELECT r.role FROM user_roles r WHERE r.user_id=u.id ORDER BY r.role)`
+	nextVersion     = `version=version+1, updated_at=now()`
 )
 
 // GetAllUsers gets a list of all the users
-func (DB SqlOps) GetAllUsers() ([]models.User, error) {
-	var user models.User
+func (DB SqlOps) GetAllUsers(ctx context.Context) ([]models.User, error) {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
 	var users []models.User
 
-	rows, err := Instance.Db.Query(GetAllUsersQuery)
+	rows, err := traced(DB.Db).QueryContext(ctx, GetAllUsersQuery)
 	if err != nil {
-		return users, err
+		return users, translateError(err)
 	}
+	defer rows.Close()
 	for rows.Next() {
-		if err = rows.Scan(&user.Email, &user.Name, &user.Password, &user.CreatedAt); err != nil {
-			return users, err
+		user, err := scanUser(rows)
+		if err != nil {
+			return users, translateError(err)
 		}
-		users = append(users, user)
+		users = append(users, *user)
 	}
-	return users, nil
+	return users, translateError(rows.Err())
 }
 
 // DeleteUser deletes an existing user in the users table
-func (DB SqlOps) DeleteUser(email string) error {
-	if _, err := Instance.Db.Exec(DeleteUserQuery, email); err != nil {
-		return err
-	}
-	return nil
+func (DB SqlOps) DeleteUser(ctx context.Context, email string) error {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
+	return DB.auditedUpdate(ctx, models.AuditDelete, LockUserQuery, email, func(tx conn, user *models.User) (sql.Result, error) {
+		return tx.ExecContext(ctx, DeleteUserQuery, email)
+	})
+}
+
+// DeleteUserByID deletes an existing user in the users table, given a non-zero version
+// only if the user still has this version
+func (DB SqlOps) DeleteUserByID(ctx context.Context, id string, version int64) error {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
+	return DB.auditedUpdate(ctx, models.AuditDelete, LockUserByIDQuery, id, func(tx conn, user *models.User) (sql.Result, error) {
+		return tx.ExecContext(ctx, DeleteUserByIDQuery, user.ID, version)
+	})
 }
 
-// InsertNewUser inserts a new user into the users table
-func (DB SqlOps) InsertNewUser(user models.User) error {
-	if _, err := Instance.Db.Exec(InsertNewUserQuery, user.Email, user.Name, user.Password); err != nil {
+// InsertNewUser inserts a new user into the users table, the user gets the member role
+func (DB SqlOps) InsertNewUser(ctx context.Context, user models.User) error {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
+	if user.ID == "" {
+		user.ID = models.NewUserID()
+	}
+	tx, err := DB.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return translateError(err)
+	}
+	defer tx.Rollback()
+	if _, err = traced(tx).ExecContext(ctx, InsertNewUserQuery, user.ID, user.Email, user.Name, user.Password); err != nil {
+		return translateError(err)
+	}
+	if _, err = traced(tx).ExecContext(ctx, GrantRoleQuery, user.Email, models.RoleMember); err != nil {
+		return translateError(err)
+	}
+	if err = insertAuditEntry(ctx, traced(tx), models.NewAuditEntry(ctx, models.AuditCreate, nil, &user)); err != nil {
 		return err
 	}
-	return nil
+	return translateError(tx.Commit())
 }
 
 // UpdateNameAndPassUser updates the name and pass for an existing user in the users table
-func (DB SqlOps) UpdateNameAndPassUser(user models.User) error {
-	if _, err := Instance.Db.Exec(UpdateUserQuery, user.Name, user.Password, user.Email); err != nil {
+func (DB SqlOps) UpdateNameAndPassUser(ctx context.Context, user models.User) error {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
+	return DB.auditedUpdate(ctx, models.AuditUpdate, LockUserQuery, user.Email, func(tx conn, _ *models.User) (sql.Result, error) {
+		return tx.ExecContext(ctx, UpdateUserQuery, user.Name, user.Password, user.Email, user.Version)
+	})
+}
+
+// PatchUser updates only the fields of the patch in a single statement, so concurrent
+// patches of different fields don't overwrite each other
+func (DB SqlOps) PatchUser(ctx context.Context, id string, patch models.UserPatch) error {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
+	return DB.auditedUpdate(ctx, models.AuditUpdate, LockUserByIDQuery, id, func(tx conn, user *models.User) (sql.Result, error) {
+		return tx.ExecContext(ctx, PatchUserQuery, patch.Name, patch.Password, user.ID, patch.Version)
+	})
+}
+
+// IsExistsInUsersTable checks if the usr exists in the users table
+func (DB SqlOps) IsExistsInUsersTable(ctx context.Context, email string) (*models.User, error) {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
+	return scanUser(traced(DB.Db).QueryRowContext(ctx, IsExistsUserQuery, email))
+}
+
+// GetUserByID gets the user according to its ID
+func (DB SqlOps) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
+	if !models.IsUserID(id) {
+		return &models.User{}, models.ErrUserNotFound
+	}
+	return scanUser(traced(DB.Db).QueryRowContext(ctx, GetUserByIDQuery, id))
+}
+
+// ChangeEmail changes the email of the user in a single statement, the references
+// use the user ID so they are not affected
+func (DB SqlOps) ChangeEmail(ctx context.Context, id, email string, version int64) error {
+	ctx, cancel := DB.withTimeout(ctx)
+	defer cancel()
+	return DB.auditedUpdate(ctx, models.AuditUpdate, LockUserByIDQuery, id, func(tx conn, user *models.User) (sql.Result, error) {
+		return tx.ExecContext(ctx, ChangeEmailQuery, email, user.ID, version)
+	})
+}
+
+// auditedUpdate runs the update of the user locked by the lock query (by email or ID) and records its
+// audit entry in the same transaction, so the entry has the user before and after the update. The user
+// exists and is locked, so the update affects no row only when the user has another version
+func (DB SqlOps) auditedUpdate(ctx context.Context, action, lockQuery, user string, update func(tx conn, user *models.User) (sql.Result, error)) error {
+	if lockQuery == LockUserByIDQuery && !models.IsUserID(user) {
+		return models.ErrUserNotFound
+	}
+	tx, err := DB.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return translateError(err)
+	}
+	defer tx.Rollback()
+	before, err := scanUser(traced(tx).QueryRowContext(ctx, lockQuery, user))
+	if err != nil {
+		return err
+	}
+	result, err := update(traced(tx), before)
+	if err != nil {
+		return translateError(err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return translateError(err)
+	} else if rows == 0 {
+		return models.ErrVersionConflict
+	}
+	var after *models.User
+	if action != models.AuditDelete {
+		if after, err = scanUser(traced(tx).QueryRowContext(ctx, GetUserByIDQuery, before.ID)); err != nil {
+			return err
+		}
+	}
+	if err = insertAuditEntry(ctx, traced(tx), models.NewAuditEntry(ctx, action, before, after)); err != nil {
 		return err
 	}
-	return nil
+	return translateError(tx.Commit())
 }
 
-// IsExistsInUsersTable checks if the usr exists in the users table
-func (DB SqlOps) IsExistsInUsersTable(email string) (*models.User, error) {
+// withTimeout returns the context of an operation, stopped after the query timeout
+func (DB SqlOps) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if DB.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, DB.QueryTimeout)
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser scans the userColumns of the row followed by the extra columns
+func scanUser(row scanner, extra ...interface{}) (*models.User, error) {
 	var user models.User
-	row := Instance.Db.QueryRow(IsExistsUserQuery, email)
-	err := row.Scan(&user.Email, &user.Name, &user.Password, &user.CreatedAt)
-	return &user, err
+	dest := []interface{}{&user.ID, &user.Email, &user.Name, &user.Password, &user.CreatedAt, &user.UpdatedAt, &user.Version, pq.Array(&user.Roles)}
+	err := row.Scan(append(dest, extra...)...)
+	if err == sql.ErrNoRows {
+		return &user, models.ErrUserNotFound
+	}
+	return &user, translateError(err)
 }
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"gin_CRUD_server/db"
+	"gin_CRUD_server/logging"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	HealthzURL = "/healthz"
+	ReadyzURL  = "/readyz"
+	// HealthcheckCommand is the command of the server binary that checks the readiness of the running server
+	HealthcheckCommand = "healthcheck"
+
+	HealthOK          = "ok"
+	HealthUnavailable = "unavailable"
+)
+
+// healthCheck is the result of the check of a dependency
+type healthCheck struct {
+	Status  string `json:"status"`
+	Detail  string `json:"detail,omitempty"`
+	Elapsed string `json:"elapsed,omitempty"`
+}
+
+// healthResponse is the status of the server and the breakdown of its checks
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]healthCheck `json:"checks,omitempty"`
+}
+
+// registerHealthRoutes registers the liveness and readiness routes, they don't require authentication
+func (s *Server) registerHealthRoutes(router *gin.Engine) {
+	router.GET(HealthzURL, HealthzHandler)
+	router.GET(ReadyzURL, s.ReadyzHandler)
+}
+
+// HealthzHandler reports that the process is alive
+func HealthzHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, healthResponse{Status: HealthOK})
+}
+
+// ReadyzHandler reports whether the server can serve requests: the DB answers the ping within
+// the readiness timeout, it is migrated to the expected schema version and the server isn't
+// draining. It returns 503 Service Unavailable with the failed checks otherwise
+func (s *Server) ReadyzHandler(ctx *gin.Context) {
+	checkCtx, cancel := context.WithTimeout(ctx.Request.Context(), s.Config.ReadinessTimeout)
+	defer cancel()
+	response := healthResponse{Status: HealthOK, Checks: map[string]healthCheck{
+		"draining": s.checkDraining(),
+	}}
+	if checker, ok := db.Unwrap(s.DB).(db.HealthChecker); ok {
+		response.Checks["db"] = checkDB(checkCtx, checker)
+		response.Checks["migrations"] = checkMigrations(checkCtx, checker)
+	}
+	status := http.StatusOK
+	for _, check := range response.Checks {
+		if check.Status != HealthOK {
+			response.Status = HealthUnavailable
+			status = http.StatusServiceUnavailable
+		}
+	}
+	ctx.JSON(status, response)
+}
+
+// StartDraining makes the server not ready, so the load balancers stop sending it new requests
+func (s *Server) StartDraining() {
+	atomic.StoreInt32(&s.draining, 1)
+}
+
+// checkDraining checks that the server isn't draining
+func (s *Server) checkDraining() healthCheck {
+	if atomic.LoadInt32(&s.draining) != 0 {
+		return healthCheck{Status: HealthUnavailable, Detail: "the server is shutting down"}
+	}
+	return healthCheck{Status: HealthOK}
+}
+
+// checkDB checks that the DB answers the ping, the error is only logged since it may reveal the
+// address of the DB to the unauthenticated clients of the probe
+func checkDB(ctx context.Context, checker db.HealthChecker) healthCheck {
+	start := time.Now()
+	check := healthCheck{Status: HealthOK}
+	if err := checker.Ping(ctx); err != nil {
+		logging.FromContext(ctx).Warn("The DB doesn't answer the ping", logging.ErrorKey, err)
+		check = healthCheck{Status: HealthUnavailable, Detail: "the DB doesn't answer"}
+	}
+	check.Elapsed = time.Since(start).String()
+	return check
+}
+
+// checkMigrations checks that the DB is migrated to the schema version of the server, a later
+// version is accepted so the previous servers stay ready during a rolling update
+func checkMigrations(ctx context.Context, checker db.HealthChecker) healthCheck {
+	version, dirty, err := checker.SchemaVersion(ctx)
+	switch {
+	case err != nil:
+		logging.FromContext(ctx).Warn("Cannot read the schema version", logging.ErrorKey, err)
+		return healthCheck{Status: HealthUnavailable, Detail: "cannot read the schema version"}
+	case dirty:
+		return healthCheck{Status: HealthUnavailable, Detail: fmt.Sprintf("the migration %d failed", version)}
+	case version < db.SchemaVersion:
+		return healthCheck{Status: HealthUnavailable, Detail: fmt.Sprintf("the schema version is %d, expected %d", version, db.SchemaVersion)}
+	}
+	return healthCheck{Status: HealthOK, Detail: fmt.Sprintf("the schema version is %d", version)}
+}
+
+// runHealthcheck requests the readiness of the server listening on the port of the config, it lets
+// the container healthcheck run the server binary since the image has no other tools
+func runHealthcheck(config Config) error {
+	host, port, err := net.SplitHostPort(config.Port)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	client := http.Client{
+		Timeout: config.ReadinessTimeout + time.Second,
+		// The server uses its own certificate, which may be self-signed
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	resp, err := client.Get("https://" + net.JoinHostPort(host, port) + ReadyzURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("the server isn't ready: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gin_CRUD_server/db"
+	"gin_CRUD_server/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// checkedMapOps is a map DB with the results of the health checks
+type checkedMapOps struct {
+	db.TestMapOps
+	pingErr error
+	version int64
+	dirty   bool
+}
+
+// Ping returns the ping error
+func (DB checkedMapOps) Ping(ctx context.Context) error {
+	return DB.pingErr
+}
+
+// SchemaVersion returns the schema version
+func (DB checkedMapOps) SchemaVersion(ctx context.Context) (int64, bool, error) {
+	return DB.version, DB.dirty, nil
+}
+
+func TestHealthHandlers(t *testing.T) {
+	mapDB := db.NewTestMapOps("Map DB Health Test")
+	tests := []struct {
+		name       string
+		url        string
+		dbOps      models.DBOps
+		draining   bool
+		wantCode   int
+		wantFailed string
+	}{
+		{"Gets alive successfully", HealthzURL, mapDB, true, http.StatusOK, ""},
+		{"Gets ready successfully", ReadyzURL, mapDB, false, http.StatusOK, ""},
+		{"Gets ready with a later schema version successfully", ReadyzURL, checkedMapOps{TestMapOps: mapDB, version: db.SchemaVersion + 1}, false, http.StatusOK, ""},
+		{"Gets not ready due to draining", ReadyzURL, mapDB, true, http.StatusServiceUnavailable, "draining"},
+		{"Gets not ready due to failed DB ping", ReadyzURL, checkedMapOps{TestMapOps: mapDB, pingErr: errors.New("connection refused"), version: db.SchemaVersion}, false, http.StatusServiceUnavailable, "db"},
+		{"Gets not ready due to old schema version", ReadyzURL, checkedMapOps{TestMapOps: mapDB, version: db.SchemaVersion - 1}, false, http.StatusServiceUnavailable, "migrations"},
+		{"Gets not ready due to dirty migration", ReadyzURL, checkedMapOps{TestMapOps: mapDB, version: db.SchemaVersion, dirty: true}, false, http.StatusServiceUnavailable, "migrations"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, tt.dbOps)
+			if tt.draining {
+				server.StartDraining()
+			}
+			respRecorder, router := createRouterAndWriter()
+			server.registerRoutes(router)
+			request, _ := createNewRequest(http.MethodGet, tt.url, "", nil)
+			router.ServeHTTP(respRecorder, request)
+			assert.Equal(t, tt.wantCode, respRecorder.Code)
+			// The DB errors are logged but not returned
+			assert.NotContains(t, respRecorder.Body.String(), "connection refused")
+			response := healthResponse{}
+			assert.NoError(t, json.Unmarshal(respRecorder.Body.Bytes(), &response))
+			for name, check := range response.Checks {
+				if name == tt.wantFailed {
+					assert.Equal(t, HealthUnavailable, check.Status)
+					assert.NotEmpty(t, check.Detail)
+				} else {
+					assert.Equal(t, HealthOK, check.Status, name)
+				}
+			}
+		})
+	}
+}
+
+func Test_runHealthcheck(t *testing.T) {
+	server := newTestServer(t, db.NewTestMapOps("Map DB Healthcheck Test"))
+	httpsServer := httptest.NewTLSServer(server.Router)
+	defer httpsServer.Close()
+	config := server.Config
+	config.Port = httpsServer.Listener.Addr().String()
+	assert.NoError(t, runHealthcheck(config))
+	server.StartDraining()
+	assert.Error(t, runHealthcheck(config))
+	config.Port = "3000"
+	assert.Error(t, runHealthcheck(config))
+}
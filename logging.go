@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"gin_CRUD_server/logging"
+	"gin_CRUD_server/models"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestLogger carries the logger of the request in the context of the request, its entries have the
+// ID of the request and the ID of its trace. The request is logged once served, the probes and the
+// metrics scrapes at the debug level and the server errors at the error level
+func (s *Server) RequestLogger(ctx *gin.Context) {
+	start := time.Now()
+	logger := s.Logger.With(logging.RequestIDKey, ctx.GetString(RequestIDKey))
+	if span := trace.SpanContextFromContext(ctx.Request.Context()); span.IsValid() {
+		logger = logger.With(logging.TraceIDKey, span.TraceID().String())
+	}
+	ctx.Request = ctx.Request.WithContext(logging.WithLogger(ctx.Request.Context(), logger))
+	ctx.Next()
+
+	status := ctx.Writer.Status()
+	level := slog.LevelInfo
+	if isProbe(ctx.Request) {
+		level = slog.LevelDebug
+	} else if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	logger.Log(ctx.Request.Context(), level, "Request served",
+		"method", ctx.Request.Method,
+		"route", ctx.FullPath(),
+		"path", ctx.Request.URL.Path,
+		"status", status,
+		"duration_seconds", time.Since(start).Seconds(),
+		"size", ctx.Writer.Size(),
+		"client_ip", ctx.ClientIP(),
+	)
+}
+
+// Recovery recovers the panics of the handlers, the panic is logged with its stack by the logger of
+// the request and the request fails with an internal error
+func (s *Server) Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(ctx *gin.Context, err interface{}) {
+		logging.FromContext(ctx.Request.Context()).Error("Request panicked",
+			logging.ErrorKey, fmt.Sprint(err),
+			"stack", string(debug.Stack()),
+		)
+		abortWithProblem(ctx, models.CodeInternal, "an unexpected error occurred, please try again later")
+	})
+}
+
+// isProbe reports whether the request is a liveness or readiness probe or a metrics scrape
+func isProbe(request *http.Request) bool {
+	switch request.URL.Path {
+	case HealthzURL, ReadyzURL, MetricsURL:
+		return true
+	}
+	return false
+}
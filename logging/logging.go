@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces the values of the sensitive attributes
+const Redacted = "REDACTED"
+
+// The keys of the attributes of the request loggers
+const (
+	RequestIDKey = "request_id"
+	TraceIDKey   = "trace_id"
+	ErrorKey     = "error"
+)
+
+// sensitiveKeys are the parts of the attribute keys whose values are never logged
+var sensitiveKeys = []string{"password", "secret", "token", "authorization"}
+
+// emailPattern matches the emails in the logged strings
+var emailPattern = regexp.MustCompile(`([A-Za-z0-9._%+-])[A-Za-z0-9._%+-]*@([A-Za-z0-9.-]+\.[A-Za-z]{2,})`)
+
+// ParseLevel returns the level of its name (debug, info, warn or error), the info level when it is empty
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if name == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return level, errors.New("the log level must be debug, info, warn or error")
+	}
+	return level, nil
+}
+
+// New returns the JSON logger of the level writing to w, the emails and the sensitive attributes
+// (passwords, secrets and tokens) are redacted
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, ReplaceAttr: redact}))
+}
+
+// redact redacts the value of the sensitive attribute and the emails of the strings and errors,
+// the emails keep their first letter and their domain (b***@gmail.com)
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	key := strings.ToLower(attr.Key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return slog.String(attr.Key, Redacted)
+		}
+	}
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		attr.Value = slog.StringValue(RedactEmails(attr.Value.String()))
+	case slog.KindAny:
+		if err, ok := attr.Value.Any().(error); ok {
+			attr.Value = slog.StringValue(RedactEmails(err.Error()))
+		}
+	}
+	return attr
+}
+
+// RedactEmails masks the emails of the string
+func RedactEmails(s string) string {
+	return emailPattern.ReplaceAllString(s, "$1***@$2")
+}
+
+// loggerKey is the key of the logger of the context
+type loggerKey struct{}
+
+// WithLogger returns the context carrying the logger, it is the logger of the request with its ID
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger of the context, or the default logger when it carries none
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name  string
+		log   func(logger *slog.Logger)
+		want  map[string]interface{}
+		empty bool
+	}{
+		{"Logs the message as JSON successfully", func(logger *slog.Logger) {
+			logger.Info("Connected to the DB", "attempt", 2)
+		}, map[string]interface{}{"level": "INFO", "msg": "Connected to the DB", "attempt": float64(2)}, false},
+		{"Redacts the email of the message and the attributes", func(logger *slog.Logger) {
+			logger.Warn("Cannot rehash the password of bari@gmail.com", "email", "Bari.Arviv@gmail.com")
+		}, map[string]interface{}{"msg": "Cannot rehash the password of b***@gmail.com", "email": "B***@gmail.com"}, false},
+		{"Redacts the email of the error", func(logger *slog.Logger) {
+			logger.Error("Request failed", ErrorKey, errors.New("user admin@gmail.com not found"))
+		}, map[string]interface{}{"level": "ERROR", ErrorKey: "user a***@gmail.com not found"}, false},
+		{"Redacts the sensitive attributes", func(logger *slog.Logger) {
+			logger.Info("Login", "password", "1234", slog.Group("db", "password", "bari_pass"), "refresh_token", "abc")
+		}, map[string]interface{}{"password": Redacted, "db": map[string]interface{}{"password": Redacted}, "refresh_token": Redacted}, false},
+		{"Doesn't log below the level", func(logger *slog.Logger) {
+			logger.Debug("Details")
+		}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := bytes.Buffer{}
+			tt.log(New(&out, slog.LevelInfo))
+			if tt.empty {
+				assert.Empty(t, out.String())
+				return
+			}
+			entry := map[string]interface{}{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+			for key, value := range tt.want {
+				assert.Equal(t, value, entry[key], key)
+			}
+		})
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		level   string
+		want    slog.Level
+		wantErr bool
+	}{
+		{"Parses the debug level successfully", "debug", slog.LevelDebug, false},
+		{"Parses the upper case level successfully", "WARN", slog.LevelWarn, false},
+		{"Parses the empty level as info successfully", "", slog.LevelInfo, false},
+		{"Parses fail due to unknown level", "verbose", slog.LevelInfo, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, err := ParseLevel(tt.level)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLevel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, level)
+			}
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	logger := New(&bytes.Buffer{}, slog.LevelInfo)
+	assert.Same(t, logger, FromContext(WithLogger(context.Background(), logger)))
+	assert.Same(t, slog.Default(), FromContext(context.Background()))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"gin_CRUD_server/db"
+	"gin_CRUD_server/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_RequestLogger(t *testing.T) {
+	server := newTestServer(t, db.NewTestMapOps("Map DB Logger Test"))
+	tests := []struct {
+		name        string
+		url         string
+		wantCode    int
+		wantEntries []map[string]interface{}
+	}{
+		{"Logs the request with its ID", "/logged/bari@gmail.com", http.StatusOK, []map[string]interface{}{
+			{"msg": "Request served", "level": "INFO", logging.RequestIDKey: "test-request", "route": "/logged/:email", "path": "/logged/b***@gmail.com", "status": float64(http.StatusOK)},
+		}},
+		{"Logs the internal error of the request", "/failed", http.StatusInternalServerError, []map[string]interface{}{
+			{"msg": "Request failed", "level": "ERROR", logging.RequestIDKey: "test-request", logging.ErrorKey: "cannot reach a***@gmail.com"},
+			{"msg": "Request served", "level": "ERROR", "status": float64(http.StatusInternalServerError)},
+		}},
+		{"Logs the panic of the request", "/panicked", http.StatusInternalServerError, []map[string]interface{}{
+			{"msg": "Request panicked", "level": "ERROR", logging.RequestIDKey: "test-request", logging.ErrorKey: "boom"},
+			{"msg": "Request served", "level": "ERROR", "status": float64(http.StatusInternalServerError)},
+		}},
+		{"Doesn't log the probes at the info level", HealthzURL, http.StatusOK, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := bytes.Buffer{}
+			server.Logger = logging.New(&out, slog.LevelInfo)
+			respRecorder, router := createRouterAndWriter()
+			server.registerRoutes(router)
+			router.GET("/logged/:email", func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+			router.GET("/failed", func(ctx *gin.Context) { respondWithError(ctx, errors.New("cannot reach admin@gmail.com")) })
+			router.GET("/panicked", func(ctx *gin.Context) { panic("boom") })
+			request, _ := createNewRequest(http.MethodGet, tt.url, "", nil)
+			request.Header.Set(RequestIDHeader, "test-request")
+			router.ServeHTTP(respRecorder, request)
+			assert.Equal(t, tt.wantCode, respRecorder.Code)
+
+			entries := []map[string]interface{}{}
+			scanner := bufio.NewScanner(&out)
+			for scanner.Scan() {
+				entry := map[string]interface{}{}
+				require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+				entries = append(entries, entry)
+			}
+			require.Len(t, entries, len(tt.wantEntries))
+			for i, want := range tt.wantEntries {
+				for key, value := range want {
+					assert.Equal(t, value, entries[i][key], key)
+				}
+			}
+		})
+	}
+}
@@ -1,86 +1,286 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
-	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/mail"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"gin_CRUD_server/auth"
 	"gin_CRUD_server/db"
+	"gin_CRUD_server/logging"
 	"gin_CRUD_server/models"
 	"github.com/gin-gonic/gin"
 )
 
 const (
-	DBPort    = "5432"
-	Port      = ":3000"
 	FieldName = "email"
 	URL       = "/user"
 	ListURL   = "/users"
-	Host      = "database"
-	CertFile  = "/etc/ssl/certs/ssl.crt"
-	KeyFile   = "/etc/ssl/certs/ssl.key"
+	RolesURL  = "/user/roles"
+	SearchURL = "/users/search"
+
+	LoginURL    = "/auth/login"
+	RefreshURL  = "/auth/refresh"
+	LogoutURL   = "/auth/logout"
+	JWKSURL     = "/.well-known/jwks.json"
+	TokenIssuer = "gin_CRUD_server"
 )
 
-var (
-	DBApi models.DBOps
+// The defaults of the config
+const (
+	Port                = ":3000"
+	CertFile            = "/etc/ssl/certs/ssl.crt"
+	KeyFile             = "/etc/ssl/certs/ssl.key"
+	Host                = "database"
+	DBPort              = "5432"
+	DefaultQueryTimeout = 5 * time.Second
+
+	DefaultConnectTimeout    = time.Minute
+	DefaultConnectBackoff    = 500 * time.Millisecond
+	DefaultConnectMaxBackoff = 10 * time.Second
+	// The connections are closed after 30s so the pool follows the DB failovers
+	DefaultMaxIdleConns    = 2
+	DefaultConnMaxLifetime = 30 * time.Second
+
+	DefaultReadinessTimeout = 2 * time.Second
+	DefaultShutdownDelay    = 5 * time.Second
+	DefaultDrainTimeout     = 20 * time.Second
+
+	DefaultTracingExporter     = TracingNone
+	DefaultTracingEndpoint     = "http://localhost:4318"
+	DefaultTracingFlushTimeout = 5 * time.Second
+
+	DefaultLogLevel = "info"
 )
 
+type credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type roleRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type tokensResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
 func main() {
-	// Setups the DB instance
-	if err := setupDB(Host, DBPort); err != nil {
-		fmt.Println(err)
+	// The logs are JSON lines, gin doesn't print its plain-text debug logs of the routes in release mode
+	gin.SetMode(gin.ReleaseMode)
+	logger := logging.New(os.Stdout, slog.LevelInfo)
+	// The healthcheck command checks the readiness of the running server
+	if len(os.Args) > 1 && os.Args[1] == HealthcheckCommand {
+		config, _, err := LoadConfig(os.Args[2:], os.LookupEnv)
+		if err == nil {
+			err = runHealthcheck(config)
+		}
+		if err != nil {
+			logger.Error("The server isn't ready", logging.ErrorKey, err)
+			os.Exit(1)
+		}
+		return
+	}
+	config, printConfig, err := LoadConfig(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
 		return
+	} else if err != nil {
+		logger.Error("Cannot load the config", logging.ErrorKey, err)
+		os.Exit(2)
 	}
-	if _, err := setupRouter(CertFile, KeyFile, Port); err != nil {
-		fmt.Println(err)
+	if printConfig {
+		if err = config.PrintRedacted(os.Stdout); err != nil {
+			logger.Error("Cannot print the config", logging.ErrorKey, err)
+		}
+	}
+	if err = config.Validate(); err != nil {
+		logger.Error("The config is invalid", logging.ErrorKey, err)
+		os.Exit(2)
+	}
+	if printConfig {
+		return
+	}
+	level, _ := logging.ParseLevel(config.LogLevel)
+	logger = logging.New(os.Stdout, level)
+	slog.SetDefault(logger)
+	// SIGINT and SIGTERM stop the server gracefully, even while it connects to the DB
+	ctx, stop := signal.NotifyContext(logging.WithLogger(context.Background(), logger), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	// Connects to the DB, the connection is owned by the DB operations
+	sqlOps, err := db.NewSqlOps(ctx, "SQL Server", &config.DB)
+	if err != nil {
+		logger.Error("Cannot connect to the DB", logging.ErrorKey, err)
 		return
 	}
+	server, err := NewServer(config, sqlOps)
+	if err != nil {
+		logger.Error("Cannot create the server", logging.ErrorKey, err)
+		sqlOps.Close()
+		return
+	}
+	if err = server.GrantAdmins(ctx); err != nil {
+		logger.Error("Cannot grant the admin role", logging.ErrorKey, err)
+		sqlOps.Close()
+		return
+	}
+	if err = server.Run(ctx); err != nil {
+		logger.Error("The server failed", logging.ErrorKey, err)
+	}
+	// The spans still batched are exported before exiting
+	flushCtx, cancel := context.WithTimeout(context.Background(), DefaultTracingFlushTimeout)
+	defer cancel()
+	if err = server.TracerProvider.Shutdown(flushCtx); err != nil {
+		logger.Error("Cannot export the spans", logging.ErrorKey, err)
+	}
+	// The DB is closed once the requests are drained
+	if err = sqlOps.Close(); err != nil {
+		logger.Error("Cannot close the DB", logging.ErrorKey, err)
+	}
 }
 
-// setupDB setups the DB instance
-func setupDB(host, port string) error {
-	ch := make(chan error, 1)
-	dbName := os.Getenv("POSTGRES_DB")
-	dbSSL := os.Getenv("POSTGRES_SSL")
-	dbUser := os.Getenv("POSTGRES_USER")
-	dbPassword := os.Getenv("POSTGRES_PASSWORD")
+// parseDuration parses the duration, or returns the default duration when it is empty
+func parseDuration(value string, defaultDuration time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultDuration, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err == nil && duration < 0 {
+		err = fmt.Errorf("the duration %q is negative", value)
+	}
+	return duration, err
+}
 
-	config := db.NewConfig(host, port, dbUser, dbPassword, dbName, dbSSL)
-	db.GetInstance(ch, config)
-	select {
-	case err, _ := <-ch:
-		if err != nil {
-			return err
+// newPasswords returns the password hasher used for new hashes according to the algorithm,
+// hashes produced by the other supported algorithms can still be verified
+func newPasswords(algorithm string) (*auth.Passwords, error) {
+	preferred, err := auth.NewHasher(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	// The legacy plaintext passwords are verified once, then rehashed
+	if _, ok := preferred.(*auth.BcryptHasher); ok {
+		return auth.NewPasswords(preferred, auth.NewArgon2idHasher(auth.DefaultArgon2idParams), auth.NewPlaintextHasher()), nil
+	}
+	return auth.NewPasswords(preferred, auth.NewBcryptHasher(auth.DefaultBcryptCost), auth.NewPlaintextHasher()), nil
+}
+
+// newTokenIssuer returns the issuer of the access tokens signed according to the signing method,
+// HS256 uses the comma-separated secrets and RS256/EdDSA use the comma-separated PEM private key
+// files. The last secret/file signs new tokens, the previous ones only verify existing tokens
+// so that keys can be rotated without logging out the users
+func newTokenIssuer(logger *slog.Logger, method, secrets, keyFiles string) (*auth.TokenIssuer, error) {
+	keys := auth.NewKeySet()
+	switch method {
+	case "", "HS256":
+		if secrets == "" {
+			secret := make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				return nil, err
+			}
+			logger.Warn("JWT_SECRET isn't set, using a random secret (the tokens are invalidated on restart)")
+			keys.Rotate(auth.NewHMACKey(secret))
+		}
+		for _, secret := range strings.Split(secrets, ",") {
+			if secret != "" {
+				keys.Rotate(auth.NewHMACKey([]byte(secret)))
+			}
+		}
+	case "RS256", "EdDSA":
+		for _, file := range strings.Split(keyFiles, ",") {
+			data, err := os.ReadFile(strings.TrimSpace(file))
+			if err != nil {
+				return nil, fmt.Errorf("Cannot read the private key file %q: %s\n", file, err)
+			}
+			key, err := auth.ParsePrivateKeyPEM(data)
+			if err != nil {
+				return nil, fmt.Errorf("Cannot parse the private key file %q: %s\n", file, err)
+			}
+			if key.Method.Alg() != method {
+				return nil, fmt.Errorf("The private key file %q isn't a %s key\n", file, method)
+			}
+			keys.Rotate(key)
 		}
+	default:
+		return nil, fmt.Errorf("Unsupported JWT signing method %q\n", method)
 	}
-	DBApi = db.SqlOps{Name: "SQL Server"}
-	return nil
+	return auth.NewTokenIssuer(keys, TokenIssuer), nil
 }
 
-// setupRouter setups the server and the routers according to the HTTP requests
-func setupRouter(certFile, keyFile, port string) (*gin.Engine, error) {
-	// Setups the server and the routers according to the HTTP requests
-	router := gin.Default()
-	router.PUT(URL, AddUserHandler)
-	router.GET(URL, GetUserHandler)
-	router.POST(URL, UpdateUserHandler)
-	router.DELETE(URL, DeleteUserHandler)
-	router.GET(ListURL, ListUsersHandler)
+// newAdmins returns the set of the comma-separated emails of the bootstrap admins, it allows to
+// grant the admin role to the first admins before roles are granted using the API
+func newAdmins(emails string) map[string]bool {
+	admins := map[string]bool{}
+	for _, email := range strings.Split(emails, ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			admins[email] = true
+		}
+	}
+	return admins
+}
 
-	// Creates tls certificate
-	ln, err := createTLSCert(certFile, keyFile, port)
-	if err != nil || ln == nil {
-		return router, err
+// GrantAdmins grants the admin role to the existing users of the bootstrap admin emails. The roles are
+// only read from the DB, so a user signing up or changing its email to one of them later isn't an admin
+func (s *Server) GrantAdmins(ctx context.Context) error {
+	for email := range s.Admins {
+		err := s.DB.GrantRole(ctx, email, models.RoleAdmin)
+		if errors.Is(err, models.ErrUserNotFound) {
+			logging.FromContext(ctx).Warn("The admin doesn't exist, the admin role isn't granted", "email", email)
+		} else if err != nil {
+			return err
+		}
 	}
-	// Starts server with https/ssl enabled on http://localhost:Port
-	log.Fatal(router.RunListener(*ln))
-	return router, nil
+	return nil
+}
+
+// registerRoutes registers the handlers according to the HTTP requests
+func (s *Server) registerRoutes(router *gin.Engine) {
+	router.Use(s.Tracing(), RequestID, s.RequestLogger, s.Recovery(), s.Metrics.Middleware)
+	// The legacy routes read the email from the form-data or the JSON body, they are kept for
+	// compatibility and point to the /v1/users resource routes as their successor
+	router.PUT(URL, Deprecated(V1UsersURL), s.AddUserHandler)
+	// Users may always access themselves, other users require the permission of one of their roles
+	authorized := router.Group("", s.RequireAuth)
+	authorized.GET(URL, Deprecated(V1UsersURL), RequireSelfOrPermission(models.PermissionReadUsers, emailFromForm), s.GetUserHandler)
+	authorized.POST(URL, Deprecated(V1UsersURL), RequireSelfOrPermission(models.PermissionUpdateUsers, emailFromJSON), s.UpdateUserHandler)
+	authorized.DELETE(URL, Deprecated(V1UsersURL), RequireSelfOrPermission(models.PermissionDeleteUsers, emailFromForm), s.DeleteUserHandler)
+	authorized.PATCH(URL+"/:id", Deprecated(V1UserURL), RequireSelfOrPermission(models.PermissionUpdateUsers, idFromPath), s.PatchUserV1Handler)
+	authorized.GET(ListURL, RequirePermission(models.PermissionListUsers), s.ListUsersHandler)
+	authorized.GET(SearchURL, RequirePermission(models.PermissionListUsers), s.SearchUsersHandler)
+	authorized.GET(AuditURL, RequirePermission(models.PermissionReadAudit), s.UserAuditHandler)
+	authorized.PUT(RolesURL, RequirePermission(models.PermissionManageRoles), s.GrantRoleHandler)
+	authorized.DELETE(RolesURL, RequirePermission(models.PermissionManageRoles), s.RevokeRoleHandler)
+	router.POST(LoginURL, s.LoginHandler)
+	router.POST(RefreshURL, s.RefreshHandler)
+	router.POST(LogoutURL, s.LogoutHandler)
+	router.GET(JWKSURL, s.JWKSHandler)
+	s.registerV1Routes(router)
+	s.registerAdminRoutes(router)
+	s.registerHealthRoutes(router)
+	router.GET(MetricsURL, s.Metrics.Handler())
 }
 
 // createTLSCert creates tls certificate
@@ -88,8 +288,7 @@ func createTLSCert(certFile, keyFile, port string) (*net.Listener, error) {
 	// Creates tls certificate
 	certs, err := tls.LoadX509KeyPair(certFile, keyFile)
 	if err != nil {
-		fmt.Printf("Cannot load TLS certificate from certFile=%q, keyFile=%q: %s\n", certFile, keyFile, err)
-		return nil, err
+		return nil, fmt.Errorf("Cannot load TLS certificate from certFile=%q, keyFile=%q: %w", certFile, keyFile, err)
 	}
 	rootCAs, _ := x509.SystemCertPool()
 	if rootCAs == nil {
@@ -107,109 +306,449 @@ func createTLSCert(certFile, keyFile, port string) (*net.Listener, error) {
 }
 
 // AddUserHandler adds a new user
-func AddUserHandler(ctx *gin.Context) {
+func (s *Server) AddUserHandler(ctx *gin.Context) {
 	user, err := getUserFromBindJSON(ctx)
 	if err != nil {
-		ctx.String(http.StatusBadRequest, err.Error())
-		return
-	}
-	if _, err = mail.ParseAddress(user.Email); err != nil {
-		ctx.String(http.StatusBadRequest, err.Error())
+		respondWithError(ctx, err)
 		return
 	}
-	if err = DBApi.InsertNewUser(*user); err != nil {
-		ctx.String(getStatusAndMsgErr(err))
+	if err = s.addUser(ctx.Request.Context(), user); err != nil {
+		respondWithError(ctx, err)
 		return
 	}
 	ctx.String(http.StatusOK, user.Email+" added successfully!\n")
 }
 
 // GetUserHandler returns the user according to the email received
-func GetUserHandler(ctx *gin.Context) {
+func (s *Server) GetUserHandler(ctx *gin.Context) {
 	// Gets the email from the form-data
 	email, err := getEmail(ctx)
 	if err != nil {
-		ctx.String(http.StatusBadRequest, err.Error())
+		respondWithError(ctx, err)
 		return
 	}
-	user, err := DBApi.IsExistsInUsersTable(email)
+	user, err := s.DB.IsExistsInUsersTable(ctx.Request.Context(), email)
 	if err != nil {
-		ctx.String(getStatusAndMsgErr(err))
+		respondWithError(ctx, err)
 		return
 	}
-	ctx.JSON(http.StatusOK, user)
+	if _, ok := checkPreconditions(ctx, user); !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, user.WithoutPassword())
 }
 
 // UpdateUserHandler updates username & password of an existing user
-func UpdateUserHandler(ctx *gin.Context) {
+func (s *Server) UpdateUserHandler(ctx *gin.Context) {
 	user, err := getUserFromBindJSON(ctx)
 	if err != nil {
-		ctx.String(http.StatusBadRequest, err.Error())
+		respondWithError(ctx, err)
 		return
 	}
-	if err = DBApi.UpdateNameAndPassUser(*user); err != nil {
-		ctx.String(getStatusAndMsgErr(err))
+	current, err := s.DB.IsExistsInUsersTable(ctx.Request.Context(), user.Email)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	version, ok := checkPreconditions(ctx, current)
+	if !ok {
+		return
+	}
+	user.Version = version
+	if err = s.updateUser(ctx.Request.Context(), user); err != nil {
+		respondWithError(ctx, err)
 		return
 	}
 	ctx.String(http.StatusOK, user.Email+" updated successfully!\n")
 }
 
 // DeleteUserHandler deletes an existing user
-func DeleteUserHandler(ctx *gin.Context) {
+func (s *Server) DeleteUserHandler(ctx *gin.Context) {
 	// Gets the email from the form-data
 	email, err := getEmail(ctx)
 	if err != nil {
-		ctx.String(http.StatusBadRequest, err.Error())
+		respondWithError(ctx, err)
+		return
+	}
+	user, err := s.DB.IsExistsInUsersTable(ctx.Request.Context(), email)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	version, ok := checkPreconditions(ctx, user)
+	if !ok {
 		return
 	}
-	if err = DBApi.DeleteUser(email); err != nil {
-		ctx.String(getStatusAndMsgErr(err))
+	if err = s.DB.DeleteUserByID(ctx.Request.Context(), user.ID, version); err != nil {
+		respondWithError(ctx, err)
 		return
 	}
 	ctx.String(http.StatusOK, email+" deleted successfully!\n")
 }
 
-// ListUsersHandler returns a JSON array with the list of all the users
-func ListUsersHandler(ctx *gin.Context) {
-	users, err := DBApi.GetAllUsers()
+// addUser validates the email, hashes the password and inserts the new user
+func (s *Server) addUser(ctx context.Context, user *models.User) error {
+	if _, err := mail.ParseAddress(user.Email); err != nil {
+		return models.NewValidationError(models.FieldError{Field: "email", Code: models.CodeFieldInvalid, Message: "the email is invalid"})
+	}
+	user.ID = models.NewUserID()
+	return s.saveUser(ctx, user, s.DB.InsertNewUser)
+}
+
+// updateUser hashes the new password and updates the name & password of the existing user
+func (s *Server) updateUser(ctx context.Context, user *models.User) error {
+	return s.saveUser(ctx, user, s.DB.UpdateNameAndPassUser)
+}
+
+// saveUser hashes the password of the user and saves it using the DB operation
+func (s *Server) saveUser(ctx context.Context, user *models.User, save func(context.Context, models.User) error) error {
+	hash, err := s.Passwords.Hash(user.Password)
+	if err != nil {
+		return err
+	}
+	user.Password = hash
+	return save(ctx, *user)
+}
+
+// ListUsersHandler returns a JSON array with a page of the users, the users are sorted and filtered
+// according to the query parameters and the Link header holds the URL of the next page
+func (s *Server) ListUsersHandler(ctx *gin.Context) {
+	opts, err := getListUsersOptions(ctx)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	page, err := s.DB.ListUsers(ctx.Request.Context(), opts)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	for i := range page.Users {
+		page.Users[i] = page.Users[i].WithoutPassword()
+	}
+	if page.NextCursor != "" {
+		next := *ctx.Request.URL
+		query := next.Query()
+		query.Set("after", page.NextCursor)
+		next.RawQuery = query.Encode()
+		ctx.Header("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	}
+	ctx.JSON(http.StatusOK, page.Users)
+}
+
+// SearchUsersHandler returns a JSON array with the users matching the q query parameter
+// ranked by relevance, with the matched terms highlighted in the email and name
+func (s *Server) SearchUsersHandler(ctx *gin.Context) {
+	var fields []models.FieldError
+	query := ctx.Query("q")
+	if len(models.SearchTerms(query)) == 0 {
+		fields = append(fields, models.FieldError{Field: "q", Code: models.CodeFieldRequired, Message: "please add a search query to the q parameter"})
+	}
+	limit := models.DefaultSearchLimit
+	if val := ctx.Query("limit"); val != "" {
+		var err error
+		if limit, err = strconv.Atoi(val); err != nil || limit < 1 || limit > models.MaxSearchLimit {
+			fields = append(fields, models.FieldError{Field: "limit", Code: models.CodeFieldOutOfRange, Message: fmt.Sprintf("the limit must be a number between 1 and %d", models.MaxSearchLimit)})
+		}
+	}
+	if len(fields) > 0 {
+		respondWithError(ctx, models.NewValidationError(fields...))
+		return
+	}
+	results, err := s.DB.SearchUsers(ctx.Request.Context(), query, limit)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, results)
+}
+
+// GrantRoleHandler grants a role to an existing user
+func (s *Server) GrantRoleHandler(ctx *gin.Context) {
+	req, err := getRoleFromBindJSON(ctx)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	if err = s.DB.GrantRole(ctx.Request.Context(), req.Email, req.Role); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	ctx.String(http.StatusOK, fmt.Sprintf("%s role granted to %s successfully!\n", req.Role, req.Email))
+}
+
+// RevokeRoleHandler revokes a role of an existing user
+func (s *Server) RevokeRoleHandler(ctx *gin.Context) {
+	req, err := getRoleFromBindJSON(ctx)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	if err = s.DB.RevokeRole(ctx.Request.Context(), req.Email, req.Role); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	ctx.String(http.StatusOK, fmt.Sprintf("%s role revoked from %s successfully!\n", req.Role, req.Email))
+}
+
+// LoginHandler verifies the email & password and returns a new access token and refresh token
+func (s *Server) LoginHandler(ctx *gin.Context) {
+	creds := credentials{}
+	if err := bindJSON(ctx, &creds); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	if fields := requiredFields(map[string]string{"email": creds.Email, "password": creds.Password}); len(fields) > 0 {
+		respondWithError(ctx, models.NewValidationError(fields...))
+		return
+	}
+	user, err := s.verifyUserPassword(ctx.Request.Context(), creds.Email, creds.Password)
+	if errors.Is(err, auth.ErrUnknownHashFormat) {
+		logging.FromContext(ctx.Request.Context()).Warn("The stored password has an unknown hash format", "email", creds.Email)
+	}
+	if errors.Is(err, models.ErrUserNotFound) || errors.Is(err, auth.ErrMismatchedPassword) || errors.Is(err, auth.ErrUnknownHashFormat) {
+		abortWithProblem(ctx, models.CodeInvalidCredentials, "invalid email or password")
+		return
+	} else if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	s.issueTokens(ctx, user)
+}
+
+// RefreshHandler rotates the refresh token and returns a new access token and refresh token,
+// reusing an already rotated refresh token revokes all the refresh tokens of the user
+func (s *Server) RefreshHandler(ctx *gin.Context) {
+	req, err := getRefreshFromBindJSON(ctx)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	hash := auth.HashRefreshToken(req.RefreshToken)
+	token, err := s.DB.GetRefreshToken(ctx.Request.Context(), hash)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	if token.RevokedAt != nil {
+		// The token was stolen or leaked, revokes the whole session of the user
+		if err = s.DB.RevokeUserRefreshTokens(ctx.Request.Context(), token.UserID); err != nil {
+			logging.FromContext(ctx.Request.Context()).Error("Cannot revoke the refresh tokens", "user_id", token.UserID, logging.ErrorKey, err)
+		}
+	}
+	if !token.IsActive() {
+		respondWithError(ctx, models.ErrRefreshTokenNotFound)
+		return
+	}
+	// Revokes the token only if it's still active, so concurrent requests can rotate it once
+	if err = s.DB.RevokeRefreshToken(ctx.Request.Context(), hash); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	user, err := s.DB.GetUserByID(ctx.Request.Context(), token.UserID)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	s.issueTokens(ctx, user)
+}
+
+// LogoutHandler revokes the refresh token
+func (s *Server) LogoutHandler(ctx *gin.Context) {
+	req, err := getRefreshFromBindJSON(ctx)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	// Logging out twice is not an error
+	if err = s.DB.RevokeRefreshToken(ctx.Request.Context(), auth.HashRefreshToken(req.RefreshToken)); err != nil && !errors.Is(err, models.ErrRefreshTokenNotFound) {
+		respondWithError(ctx, err)
+		return
+	}
+	ctx.String(http.StatusOK, "Logged out successfully!\n")
+}
+
+// JWKSHandler returns the public keys used to verify the access tokens
+func (s *Server) JWKSHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, s.Tokens.Keys.JWKS())
+}
+
+// issueTokens returns a new access token and a new persisted refresh token for the user,
+// the tokens identify the user by its ID so they stay valid when the email changes
+func (s *Server) issueTokens(ctx *gin.Context, user *models.User) {
+	accessToken, expiresAt, err := s.Tokens.NewAccessToken(user.ID, user.Roles)
 	if err != nil {
-		ctx.String(http.StatusInternalServerError, fmt.Sprintf("Error: %s\n", err.Error()))
+		respondWithError(ctx, err)
 		return
 	}
-	ctx.JSON(http.StatusOK, users)
+	refreshToken, hash, refreshExpiresAt, err := s.Tokens.NewRefreshToken()
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	if err = s.DB.InsertRefreshToken(ctx.Request.Context(), *models.NewRefreshToken(hash, user.ID, refreshExpiresAt)); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, tokensResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(time.Until(expiresAt).Seconds()),
+		RefreshToken: refreshToken,
+	})
+}
+
+// verifyUserPassword returns the user if the password matches the stored hash, the hash is
+// transparently replaced when it was produced by another algorithm or with old parameters. The password
+// of an unknown user is verified against a dummy hash, so the response time doesn't reveal the emails
+func (s *Server) verifyUserPassword(ctx context.Context, email, password string) (*models.User, error) {
+	user, err := s.DB.IsExistsInUsersTable(ctx, email)
+	if errors.Is(err, models.ErrUserNotFound) {
+		s.Passwords.VerifyDummy(password)
+	}
+	if err != nil {
+		return user, err
+	}
+	needsRehash, err := s.Passwords.Verify(password, user.Password)
+	if err != nil {
+		return user, err
+	}
+	if needsRehash {
+		if hash, err := s.Passwords.Hash(password); err == nil {
+			user.Password = hash
+			if err = s.DB.UpdateNameAndPassUser(ctx, *user); err != nil {
+				logging.FromContext(ctx).Error("Cannot rehash the password", "email", email, logging.ErrorKey, err)
+			}
+		}
+	}
+	return user, nil
+}
+
+// bindJSON binds the received JSON to the request, it returns an invalid request error
+// without writing the response so that the handler responds with the problem
+func bindJSON(ctx *gin.Context, req interface{}) error {
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		return models.NewError(models.CodeInvalidRequest, "the body must be a valid JSON object: %s", err)
+	}
+	return nil
+}
+
+// requiredFields returns the errors of the empty fields in the order of their names
+func requiredFields(values map[string]string) []models.FieldError {
+	var fields []models.FieldError
+	for field, value := range values {
+		if value == "" {
+			fields = append(fields, models.FieldError{Field: field, Code: models.CodeFieldRequired, Message: "the " + field + " is required"})
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+	return fields
 }
 
 // getUserFromBindJSON binds the received JSON to user
 func getUserFromBindJSON(ctx *gin.Context) (*models.User, error) {
 	user := models.User{}
-	if err := ctx.BindJSON(&user); err != nil {
-		return &user, fmt.Errorf("ctx.BindJSON() Error: %s\n", err.Error())
+	if err := bindJSON(ctx, &user); err != nil {
+		return &user, err
 	}
-	if user.Email == "" || user.Name == "" || user.Password == "" {
-		return &user, fmt.Errorf("Please try again and enter email, username and password\n")
+	if fields := requiredFields(map[string]string{"email": user.Email, "name": user.Name, "password": user.Password}); len(fields) > 0 {
+		return &user, models.NewValidationError(fields...)
 	}
+	// The ID and version are set by the server and roles are changed only by the roles routes
+	user.ID = ""
+	user.Version = 0
+	user.Roles = nil
 	return &user, nil
 }
 
+// getRoleFromBindJSON binds the received JSON to the role request
+func getRoleFromBindJSON(ctx *gin.Context) (*roleRequest, error) {
+	req := roleRequest{}
+	if err := bindJSON(ctx, &req); err != nil {
+		return &req, err
+	}
+	if fields := requiredFields(map[string]string{"email": req.Email, "role": req.Role}); len(fields) > 0 {
+		return &req, models.NewValidationError(fields...)
+	}
+	if !models.IsValidRole(req.Role) {
+		return &req, models.NewValidationError(models.FieldError{Field: "role", Code: models.CodeFieldUnsupportedValue, Message: fmt.Sprintf("the role %s doesn't exist", req.Role)})
+	}
+	return &req, nil
+}
+
+// getRefreshFromBindJSON binds the received JSON to the refresh token request
+func getRefreshFromBindJSON(ctx *gin.Context) (*refreshRequest, error) {
+	req := refreshRequest{}
+	if err := bindJSON(ctx, &req); err != nil {
+		return &req, err
+	}
+	if fields := requiredFields(map[string]string{"refresh_token": req.RefreshToken}); len(fields) > 0 {
+		return &req, models.NewValidationError(fields...)
+	}
+	return &req, nil
+}
+
+// getListUsersOptions returns the users list options from the query parameters:
+// limit, after (cursor), sort (email/username/created_at), order (asc/desc),
+// name_contains, created_before and created_after (RFC 3339)
+func getListUsersOptions(ctx *gin.Context) (models.ListUsersOptions, error) {
+	var fields []models.FieldError
+	opts := models.NewListUsersOptions()
+	if limit := ctx.Query("limit"); limit != "" {
+		val, err := strconv.Atoi(limit)
+		if err != nil || val < 1 || val > models.MaxListLimit {
+			fields = append(fields, models.FieldError{Field: "limit", Code: models.CodeFieldOutOfRange, Message: fmt.Sprintf("the limit must be a number between 1 and %d", models.MaxListLimit)})
+		}
+		opts.Limit = val
+	}
+	if sortBy := ctx.Query("sort"); sortBy != "" {
+		if !models.IsValidSortBy(sortBy) {
+			fields = append(fields, models.FieldError{Field: "sort", Code: models.CodeFieldUnsupportedValue, Message: "please use email, username or created_at"})
+		}
+		opts.SortBy = sortBy
+		// Sorting by another field is ascending by default
+		opts.Desc = false
+	}
+	switch order := ctx.Query("order"); order {
+	case "":
+	case "asc":
+		opts.Desc = false
+	case "desc":
+		opts.Desc = true
+	default:
+		fields = append(fields, models.FieldError{Field: "order", Code: models.CodeFieldUnsupportedValue, Message: "the order must be asc or desc"})
+	}
+	opts.NameContains = ctx.Query("name_contains")
+	for _, param := range []string{"created_after", "created_before"} {
+		if val := ctx.Query(param); val != "" {
+			date, err := time.Parse(time.RFC3339, val)
+			if err != nil {
+				fields = append(fields, models.FieldError{Field: param, Code: models.CodeFieldInvalid, Message: "the " + param + " must be an RFC 3339 date"})
+			} else if param == "created_after" {
+				opts.CreatedAfter = &date
+			} else {
+				opts.CreatedBefore = &date
+			}
+		}
+	}
+	if len(fields) > 0 {
+		return opts, models.NewValidationError(fields...)
+	}
+	opts.After = ctx.Query("after")
+	if _, err := opts.DecodeCursor(); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
 // getEmail returns the email from the form-data
 func getEmail(ctx *gin.Context) (string, error) {
 	email := ctx.PostForm(FieldName)
 	if email == "" {
-		return email, fmt.Errorf("Please add an email to the form-data request\n")
+		return email, models.NewValidationError(models.FieldError{Field: FieldName, Code: models.CodeFieldRequired, Message: "please add an email to the form-data request"})
 	}
 	if _, err := mail.ParseAddress(email); err != nil {
-		return email, err
+		return email, models.NewValidationError(models.FieldError{Field: FieldName, Code: models.CodeFieldInvalid, Message: "the email is invalid"})
 	}
 	return email, nil
 }
-
-// getStatusAndMsgErr returns the status code and message error according to the error received
-func getStatusAndMsgErr(err error) (int, string) {
-	var status int
-	if err == sql.ErrNoRows {
-		status = http.StatusNotFound
-	} else {
-		status = http.StatusInternalServerError
-	}
-	return status, fmt.Sprintf("Error: %s\n", err.Error())
-}
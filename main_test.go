@@ -2,24 +2,30 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"gin_CRUD_server/auth"
 	"gin_CRUD_server/db"
+	"gin_CRUD_server/logging"
 	"gin_CRUD_server/models"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
 	TestUser = models.NewUser(TestEmail, "bari", "1234")
-	MapDB    = db.TestMapOps{Name: "Map DB Test", Users: make(map[string]models.User)}
+	MapDB    = db.NewTestMapOps("Map DB Test")
 )
 
 const (
@@ -54,23 +60,28 @@ func Test_createTLSCert(t *testing.T) {
 }
 
 func TestListUsersHandler(t *testing.T) {
-	DBApi = MapDB
+	server := newTestServer(t, MapDB)
 	tests := []struct {
 		name     string
 		url      string
 		wantCode int
 	}{
 		{"Failed to get users list due to incorrect URL", URL, http.StatusNotFound},
-		{"Gets fail due to empty users map", ListURL, http.StatusInternalServerError},
+		{"Gets an empty list due to empty users map", ListURL, http.StatusOK},
+		{"Gets fail due to invalid limit", ListURL + "?limit=0", http.StatusUnprocessableEntity},
+		{"Gets fail due to invalid sort field", ListURL + "?sort=password", http.StatusUnprocessableEntity},
+		{"Gets fail due to invalid order", ListURL + "?order=up", http.StatusUnprocessableEntity},
+		{"Gets fail due to invalid date", ListURL + "?created_after=yesterday", http.StatusUnprocessableEntity},
+		{"Gets fail due to invalid cursor", ListURL + "?after=abc", http.StatusUnprocessableEntity},
 		{"Gets users list successfully (if there are users in the folder)", ListURL, http.StatusOK},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Creates gin router & http test
 			respRecorder, router := createRouterAndWriter()
-			router.GET(ListURL, ListUsersHandler)
+			router.GET(ListURL, server.ListUsersHandler)
 			if tt.wantCode == http.StatusOK {
-				DBApi.InsertNewUser(*TestUser)
+				server.DB.InsertNewUser(context.Background(), *TestUser)
 			}
 			// Creates a request
 			request, err := createNewRequest(http.MethodGet, tt.url, "", nil)
@@ -85,8 +96,100 @@ func TestListUsersHandler(t *testing.T) {
 	}
 }
 
+func TestListUsersHandler_Pagination(t *testing.T) {
+	server := newTestServer(t, db.NewTestMapOps("Map DB Pagination Test"))
+	emails := []string{"a@gmail.com", "b@gmail.com", "c@gmail.com", "d@gmail.com", "e@gmail.com"}
+	names := []string{"dana", "bari", "Dan", "carmel", "avi"}
+	for i, email := range emails {
+		server.DB.InsertNewUser(context.Background(), *models.NewUser(email, names[i], "1234"))
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantEmails []string
+	}{
+		{"Lists by email descending by default", "?limit=2", []string{"e@gmail.com", "d@gmail.com", "c@gmail.com", "b@gmail.com", "a@gmail.com"}},
+		{"Lists by username ascending", "?limit=2&sort=username", []string{"e@gmail.com", "b@gmail.com", "d@gmail.com", "c@gmail.com", "a@gmail.com"}},
+		{"Lists by creation date descending", "?limit=3&sort=created_at&order=desc", []string{"e@gmail.com", "d@gmail.com", "c@gmail.com", "b@gmail.com", "a@gmail.com"}},
+		{"Lists names containing dan (case insensitive)", "?limit=1&name_contains=DAN&sort=email", []string{"a@gmail.com", "c@gmail.com"}},
+		{"Lists users created before now", "?created_before=2999-01-01T00:00:00Z&sort=email", emails},
+		{"Lists no users created after now", "?created_after=2999-01-01T00:00:00Z", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Follows the Link header until the last page
+			gotEmails := []string{}
+			url := ListURL + tt.query
+			for url != "" {
+				respRecorder, router := createRouterAndWriter()
+				router.GET(ListURL, server.ListUsersHandler)
+				request, _ := createNewRequest(http.MethodGet, url, "", nil)
+				router.ServeHTTP(respRecorder, request)
+				assert.Equal(t, http.StatusOK, respRecorder.Code)
+				var users []models.User
+				assert.NoError(t, json.Unmarshal(respRecorder.Body.Bytes(), &users))
+				for _, user := range users {
+					assert.Empty(t, user.Password)
+					gotEmails = append(gotEmails, user.Email)
+				}
+				url = strings.TrimSuffix(strings.TrimPrefix(respRecorder.Header().Get("Link"), "<"), `>; rel="next"`)
+			}
+			assert.Equal(t, tt.wantEmails, gotEmails)
+		})
+	}
+}
+
+func TestSearchUsersHandler(t *testing.T) {
+	server := newTestServer(t, db.NewTestMapOps("Map DB Search Test"))
+	server.DB.InsertNewUser(context.Background(), *models.NewUser("bari@gmail.com", "Bari Arviv", "1234"))
+	server.DB.InsertNewUser(context.Background(), *models.NewUser("barbara@yahoo.com", "Barbara", "1234"))
+	server.DB.InsertNewUser(context.Background(), *models.NewUser("avi@gmail.com", "Avi Cohen", "1234"))
+
+	tests := []struct {
+		name           string
+		query          string
+		wantCode       int
+		wantEmails     []string
+		wantHighlights string
+	}{
+		{"Searches fail due to missing query", "", http.StatusUnprocessableEntity, nil, ""},
+		{"Searches fail due to query without words", "?q=%26%7C", http.StatusUnprocessableEntity, nil, ""},
+		{"Searches fail due to invalid limit", "?q=bari&limit=1000", http.StatusUnprocessableEntity, nil, ""},
+		{"Searches by word prefix", "?q=bar", http.StatusOK, []string{"barbara@yahoo.com", "bari@gmail.com"}, "<mark>Barbar</mark>a"},
+		{"Searches by several words", "?q=bari+gmail", http.StatusOK, []string{"bari@gmail.com"}, "<mark>Bari</mark> Arviv"},
+		{"Searches by email domain", "?q=gmail&limit=1", http.StatusOK, []string{"avi@gmail.com"}, "Avi Cohen"},
+		{"Searches with a typo", "?q=cohan", http.StatusOK, []string{"avi@gmail.com"}, "Avi Cohen"},
+		{"Searches without results", "?q=xyz", http.StatusOK, []string{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			respRecorder, router := createRouterAndWriter()
+			router.GET(SearchURL, server.SearchUsersHandler)
+			request, _ := createNewRequest(http.MethodGet, SearchURL+tt.query, "", nil)
+			router.ServeHTTP(respRecorder, request)
+			assert.Equal(t, tt.wantCode, respRecorder.Code)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var results []models.UserSearchResult
+			assert.NoError(t, json.Unmarshal(respRecorder.Body.Bytes(), &results))
+			gotEmails := []string{}
+			for _, result := range results {
+				assert.Empty(t, result.User.Password)
+				gotEmails = append(gotEmails, result.User.Email)
+			}
+			assert.Equal(t, tt.wantEmails, gotEmails)
+			if len(results) > 0 {
+				assert.Equal(t, tt.wantHighlights, results[0].Highlights["name"])
+			}
+		})
+	}
+}
+
 func TestAddUserHandler(t *testing.T) {
-	DBApi = MapDB
+	server := newTestServer(t, MapDB)
+	MapDB.DeleteUser(context.Background(), TestEmail)
 	tests := []struct {
 		name     string
 		user     *models.User
@@ -94,16 +197,17 @@ func TestAddUserHandler(t *testing.T) {
 		wantCode int
 	}{
 		{"Adds a new user successfully", TestUser, URL, http.StatusOK},
-		{"Adds fail due to incorrect user (nil)", nil, URL, http.StatusBadRequest},
+		{"Adds fail due to the existing email", models.NewUser("BARI@gmail.com", "bari", "1234"), URL, http.StatusConflict},
+		{"Adds fail due to incorrect user (nil)", nil, URL, http.StatusUnprocessableEntity},
 		{"Adds fail due to incorrect URL", TestUser, SlashSeparator, http.StatusNotFound},
-		{"Adds fail due to incorrect empty user", &models.User{}, URL, http.StatusBadRequest},
-		{"Adds fail due to the invalid email", models.NewUser("abc", "bari", "1234"), URL, http.StatusBadRequest},
+		{"Adds fail due to incorrect empty user", &models.User{}, URL, http.StatusUnprocessableEntity},
+		{"Adds fail due to the invalid email", models.NewUser("abc", "bari", "1234"), URL, http.StatusUnprocessableEntity},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Creates gin router & http test
 			respRecorder, router := createRouterAndWriter()
-			router.PUT(URL, AddUserHandler)
+			router.PUT(URL, server.AddUserHandler)
 			// Prints the users map
 			printUsersMap()
 			// Creates a request
@@ -121,8 +225,8 @@ func TestAddUserHandler(t *testing.T) {
 }
 
 func TestGetUserHandler(t *testing.T) {
-	DBApi = MapDB
-	DBApi.InsertNewUser(*TestUser)
+	server := newTestServer(t, MapDB)
+	server.DB.InsertNewUser(context.Background(), *TestUser)
 
 	tests := []struct {
 		name     string
@@ -130,8 +234,8 @@ func TestGetUserHandler(t *testing.T) {
 		email    string
 		wantCode int
 	}{
-		{"Gets fail due to empty email", URL, "", http.StatusBadRequest},
-		{"Gets fail due to the invalid email", URL, "abc", http.StatusBadRequest},
+		{"Gets fail due to empty email", URL, "", http.StatusUnprocessableEntity},
+		{"Gets fail due to the invalid email", URL, "abc", http.StatusUnprocessableEntity},
 		{"Gets an existing user successfully", URL, TestUser.Email, http.StatusOK},
 		{"Gets fail due to the user doesn't exist", URL, "a@gmail.com", http.StatusNotFound},
 		{"Gets fail due to incorrect URL", SlashSeparator, TestUser.Email, http.StatusNotFound},
@@ -140,7 +244,7 @@ func TestGetUserHandler(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Creates gin router & http test
 			respRecorder, router := createRouterAndWriter()
-			router.GET(URL, GetUserHandler)
+			router.GET(URL, server.GetUserHandler)
 			// Prints the users map
 			printUsersMap()
 			// Performs the request
@@ -156,8 +260,8 @@ func TestGetUserHandler(t *testing.T) {
 }
 
 func TestUpdateUserHandler(t *testing.T) {
-	DBApi = MapDB
-	DBApi.InsertNewUser(*TestUser)
+	server := newTestServer(t, MapDB)
+	server.DB.InsertNewUser(context.Background(), *TestUser)
 
 	tests := []struct {
 		name     string
@@ -165,9 +269,9 @@ func TestUpdateUserHandler(t *testing.T) {
 		url      string
 		wantCode int
 	}{
-		{"Updates fail due to incorrect user (nil)", nil, URL, http.StatusBadRequest},
+		{"Updates fail due to incorrect user (nil)", nil, URL, http.StatusUnprocessableEntity},
 		{"Updates fail due to incorrect URL", TestUser, SlashSeparator, http.StatusNotFound},
-		{"Updates fail due to incorrect empty user", &models.User{}, URL, http.StatusBadRequest},
+		{"Updates fail due to incorrect empty user", &models.User{}, URL, http.StatusUnprocessableEntity},
 		{"Updates an existing user successfully", models.NewUser(TestEmail, "bari2", "12345"), URL, http.StatusOK},
 		{"Updates fail due to incorrect email", models.NewUser(TestEmail+"abc", "bari", "1234"), URL, http.StatusNotFound},
 	}
@@ -175,7 +279,7 @@ func TestUpdateUserHandler(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Creates gin router & http test
 			respRecorder, router := createRouterAndWriter()
-			router.POST(URL, UpdateUserHandler)
+			router.POST(URL, server.UpdateUserHandler)
 			// Prints the users map
 			printUsersMap()
 			// Creates a request
@@ -193,8 +297,8 @@ func TestUpdateUserHandler(t *testing.T) {
 }
 
 func TestDeleteUserHandler(t *testing.T) {
-	DBApi = MapDB
-	DBApi.InsertNewUser(*TestUser)
+	server := newTestServer(t, MapDB)
+	server.DB.InsertNewUser(context.Background(), *TestUser)
 
 	tests := []struct {
 		name     string
@@ -202,9 +306,9 @@ func TestDeleteUserHandler(t *testing.T) {
 		url      string
 		wantCode int
 	}{
-		{"Deletes fail due to empty email", "", URL, http.StatusBadRequest},
+		{"Deletes fail due to empty email", "", URL, http.StatusUnprocessableEntity},
 		{"Deletes user successfully", TestUser.Email, URL, http.StatusOK},
-		{"Deletes fail due to the invalid email", "abc", URL, http.StatusBadRequest},
+		{"Deletes fail due to the invalid email", "abc", URL, http.StatusUnprocessableEntity},
 		{"Deletes fail due to incorrect URL", TestUser.Email, SlashSeparator, http.StatusNotFound},
 		{"Deletes fail due to the user doesn't exist", TestUser.Email + "abc", URL, http.StatusNotFound},
 	}
@@ -212,7 +316,7 @@ func TestDeleteUserHandler(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Creates gin router & http test
 			respRecorder, router := createRouterAndWriter()
-			router.DELETE(URL, DeleteUserHandler)
+			router.DELETE(URL, server.DeleteUserHandler)
 			// Prints the users map
 			printUsersMap()
 			// Performs the request
@@ -227,31 +331,153 @@ func TestDeleteUserHandler(t *testing.T) {
 	}
 }
 
-func Test_getStatusAndMsgErr(t *testing.T) {
+func Test_parseDuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"Parses the default duration of empty value", "", DefaultQueryTimeout, false},
+		{"Parses the duration", "1500ms", 1500 * time.Millisecond, false},
+		{"Parses no timeout", "0", 0, false},
+		{"Fails due to invalid duration", "5", 0, true},
+		{"Fails due to negative duration", "-1s", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDuration(tt.value, DefaultQueryTimeout)
+			assert.Equal(t, tt.wantErr, err != nil)
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_verifyUserPassword(t *testing.T) {
+	server := newTestServer(t, MapDB)
+	bcryptHash, _ := auth.NewBcryptHasher(4).Hash("1234")
+	server.DB.InsertNewUser(context.Background(), *models.NewUser(TestEmail, "bari", bcryptHash))
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{"Verifies fail due to wrong password", "12345", true},
+		{"Verifies and rehashes the bcrypt password successfully", "1234", false},
+		{"Verifies the rehashed password successfully", "1234", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := server.verifyUserPassword(context.Background(), TestEmail, tt.password)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+	user, _ := server.DB.IsExistsInUsersTable(context.Background(), TestEmail)
+	assert.True(t, strings.HasPrefix(user.Password, "$argon2id$"))
+	server.DB.DeleteUser(context.Background(), TestEmail)
+}
+
+func TestLoginHandler_LegacyPasswords(t *testing.T) {
 	tests := []struct {
 		name       string
-		err        error
-		wantStatus int
+		stored     string
+		password   string
+		wantCode   int
+		wantRehash bool
 	}{
-		{"Gets status code 404", sql.ErrNoRows, http.StatusNotFound},
-		{"Gets status code 500", fmt.Errorf("error"), http.StatusInternalServerError},
+		{"Logs in and rehashes the legacy plaintext password successfully", "1234", "1234", http.StatusOK, true},
+		{"Logs in fail due to wrong legacy plaintext password", "1234", "12345", http.StatusUnauthorized, false},
+		{"Logs in fail due to unknown hash format", "$argon2id$v=19$m=1024,t=0,p=1$c2FsdA$a2V5", "1234", http.StatusUnauthorized, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, _ := getStatusAndMsgErr(tt.err)
-			if got != tt.wantStatus {
-				t.Errorf("getStatusAndMsg() got = %v, want %v", got, tt.wantStatus)
+			server := newTestServer(t, db.NewTestMapOps("Map DB Legacy Passwords Test"))
+			require.NoError(t, server.DB.InsertNewUser(context.Background(), *models.NewUser(TestEmail, "bari", tt.stored)))
+			assert.Equal(t, tt.wantCode, performJSONRequest(http.MethodPost, LoginURL, server.LoginHandler, credentials{TestEmail, tt.password}, &tokensResponse{}))
+			user, _ := server.DB.IsExistsInUsersTable(context.Background(), TestEmail)
+			assert.Equal(t, tt.wantRehash, user.Password != tt.stored)
+			if tt.wantRehash {
+				assert.True(t, strings.HasPrefix(user.Password, "$argon2id$"))
 			}
 		})
 	}
 }
 
-func Test_setupRouter(t *testing.T) {
-	go func() {
-		if _, err := setupRouter(CertFileTest, KeyFileTest, ":3001"); err != nil {
-			t.Errorf("setupRouter() error = %v\n", err)
-		}
-	}()
+func TestAuthHandlers(t *testing.T) {
+	server := newTestServer(t, MapDB)
+	hash, _ := server.Passwords.Hash("1234")
+	user := models.NewUser(TestEmail, "bari", hash)
+	server.DB.InsertNewUser(context.Background(), *user)
+	defer server.DB.DeleteUser(context.Background(), TestEmail)
+
+	// Logs in and rotates the refresh token
+	tokens := tokensResponse{}
+	assert.Equal(t, http.StatusOK, performJSONRequest(http.MethodPost, LoginURL, server.LoginHandler, credentials{TestEmail, "1234"}, &tokens))
+	claims, err := server.Tokens.ParseAccessToken(tokens.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, claims.Subject)
+	first := tokens.RefreshToken
+	assert.Equal(t, http.StatusOK, performJSONRequest(http.MethodPost, RefreshURL, server.RefreshHandler, refreshRequest{first}, &tokens))
+	second := tokens.RefreshToken
+	assert.NotEqual(t, first, second)
+
+	tests := []struct {
+		name     string
+		url      string
+		handler  gin.HandlerFunc
+		body     interface{}
+		wantCode int
+	}{
+		{"Logins fail due to wrong password", LoginURL, server.LoginHandler, credentials{TestEmail, "12345"}, http.StatusUnauthorized},
+		{"Logins fail due to unknown user", LoginURL, server.LoginHandler, credentials{"a@gmail.com", "1234"}, http.StatusUnauthorized},
+		{"Logins fail due to missing password", LoginURL, server.LoginHandler, credentials{Email: TestEmail}, http.StatusUnprocessableEntity},
+		{"Refreshes fail due to unknown token", RefreshURL, server.RefreshHandler, refreshRequest{"abc"}, http.StatusUnauthorized},
+		{"Refreshes fail due to reused token (revokes the session)", RefreshURL, server.RefreshHandler, refreshRequest{first}, http.StatusUnauthorized},
+		{"Refreshes fail due to the revoked session", RefreshURL, server.RefreshHandler, refreshRequest{second}, http.StatusUnauthorized},
+		{"Logouts fail due to missing token", LogoutURL, server.LogoutHandler, refreshRequest{}, http.StatusUnprocessableEntity},
+		{"Logouts successfully", LogoutURL, server.LogoutHandler, refreshRequest{second}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantCode, performJSONRequest(http.MethodPost, tt.url, tt.handler, tt.body, nil))
+		})
+	}
+}
+
+func Test_newTokenIssuer(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		secrets  string
+		keyFiles string
+		wantErr  bool
+	}{
+		{"Setups HS256 with a random secret", "", "", "", false},
+		{"Setups HS256 with rotated secrets", "HS256", "old,new", "", false},
+		{"Setups fail due to missing key file", "RS256", "", "missing.pem", true},
+		{"Setups fail due to the TLS certificate instead of a key", "EdDSA", "", CertFileTest, true},
+		{"Setups fail due to unsupported method", "none", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newTokenIssuer(logging.New(io.Discard, slog.LevelInfo), tt.method, tt.secrets, tt.keyFiles); (err != nil) != tt.wantErr {
+				t.Errorf("newTokenIssuer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// newTestServer creates a server using the DB operations, its access tokens are signed with a known secret
+func newTestServer(t *testing.T, dbOps models.DBOps) *Server {
+	config := DefaultConfig()
+	config.JWTSecrets = "secret"
+	server, err := NewServer(config, dbOps)
+	require.NoError(t, err)
+	server.Logger = logging.New(io.Discard, slog.LevelInfo)
+	return server
 }
 
 // createRouterAndWriter creates gin router & http test record
@@ -284,6 +510,19 @@ func newFormDataRequest(email, url, method string) (*http.Request, error) {
 	return createNewRequest(method, url, writer.FormDataContentType(), body)
 }
 
+// performJSONRequest performs a JSON request on the handler, decodes the response into out and returns the status code
+func performJSONRequest(method, url string, handler gin.HandlerFunc, body, out interface{}) int {
+	respRecorder, router := createRouterAndWriter()
+	router.Handle(method, url, handler)
+	buf, _ := json.Marshal(body)
+	request, _ := createNewRequest(method, url, "application/json", bytes.NewBuffer(buf))
+	router.ServeHTTP(respRecorder, request)
+	if out != nil {
+		json.Unmarshal(respRecorder.Body.Bytes(), out)
+	}
+	return respRecorder.Code
+}
+
 // newBindJSONRequest creates an HTTP request and adds JSON to the body
 func newBindJSONRequest(user *models.User, url, method string) (*http.Request, error) {
 	buf, err := json.Marshal(&user)
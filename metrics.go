@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"gin_CRUD_server/db"
+	"gin_CRUD_server/models"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	MetricsURL = "/metrics"
+	// UnmatchedRoute is the route label of the requests matching no route, so the unknown paths
+	// don't create a time series each
+	UnmatchedRoute = "unmatched"
+)
+
+// Metrics are the Prometheus metrics of a server, each server has its own registry
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	requests         *prometheus.CounterVec
+	requestsDuration *prometheus.HistogramVec
+	requestsInFlight prometheus.Gauge
+	dbDuration       *prometheus.HistogramVec
+	dbErrors         *prometheus.CounterVec
+}
+
+// NewMetrics returns the metrics of the requests and of the DB operations, with the metrics of the
+// Go runtime and of the process
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "The number of the HTTP requests by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		requestsDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "The latency of the HTTP requests by method and route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		requestsInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "The number of the HTTP requests being served.",
+		}),
+		dbDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "db_operation_duration_seconds",
+			Help:    "The duration of the DB operations by operation.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"operation"}),
+		dbErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "db_operation_errors_total",
+			Help: "The number of the failed DB operations by operation and error code.",
+		}, []string{"operation", "code"}),
+	}
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.requestsDuration, m.requestsInFlight, m.dbDuration, m.dbErrors,
+	)
+	return m
+}
+
+// Handler serves the metrics of the registry in the Prometheus text format
+func (m *Metrics) Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{}))
+}
+
+// Middleware counts the requests and observes their latency by route, the route is the pattern of
+// the route (/v1/users/:id) so the IDs of the paths don't create a time series each
+func (m *Metrics) Middleware(ctx *gin.Context) {
+	start := time.Now()
+	m.requestsInFlight.Inc()
+	defer m.requestsInFlight.Dec()
+	ctx.Next()
+
+	route := ctx.FullPath()
+	if route == "" {
+		route = UnmatchedRoute
+	}
+	method := ctx.Request.Method
+	m.requests.WithLabelValues(method, route, strconv.Itoa(ctx.Writer.Status())).Inc()
+	m.requestsDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+}
+
+// ObserveDB observes the duration of the DB operation and counts it by error code when it fails,
+// the errors which aren't typed are counted as internal errors
+func (m *Metrics) ObserveDB(operation string, duration time.Duration, err error) {
+	m.dbDuration.WithLabelValues(operation).Observe(duration.Seconds())
+	if err == nil {
+		return
+	}
+	code := models.CodeInternal
+	var dbErr *models.Error
+	if errors.As(err, &dbErr) {
+		code = dbErr.Code
+	}
+	m.dbErrors.WithLabelValues(operation, code).Inc()
+}
+
+// RegisterPool registers the statistics of the connection pool of the DB
+func (m *Metrics) RegisterPool(pool db.PoolStatsProvider) {
+	m.Registry.MustRegister(poolCollector{pool: pool})
+}
+
+// The descriptions of the metrics of the connection pool
+var (
+	poolMaxOpenDesc = prometheus.NewDesc("db_pool_max_open_connections",
+		"The maximum number of the open connections of the pool.", nil, nil)
+	poolOpenDesc = prometheus.NewDesc("db_pool_open_connections",
+		"The number of the open connections of the pool, in use and idle.", nil, nil)
+	poolInUseDesc = prometheus.NewDesc("db_pool_in_use_connections",
+		"The number of the connections in use.", nil, nil)
+	poolIdleDesc = prometheus.NewDesc("db_pool_idle_connections",
+		"The number of the idle connections.", nil, nil)
+	poolWaitCountDesc = prometheus.NewDesc("db_pool_wait_count_total",
+		"The number of the connections waited for.", nil, nil)
+	poolWaitDurationDesc = prometheus.NewDesc("db_pool_wait_duration_seconds_total",
+		"The time spent waiting for the connections.", nil, nil)
+	poolClosedDesc = prometheus.NewDesc("db_pool_closed_connections_total",
+		"The number of the connections closed by reason.", []string{"reason"}, nil)
+)
+
+// poolCollector collects the statistics of the connection pool when the metrics are scraped
+type poolCollector struct {
+	pool db.PoolStatsProvider
+}
+
+// Describe sends the descriptions of the metrics of the pool
+func (c poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{poolMaxOpenDesc, poolOpenDesc, poolInUseDesc, poolIdleDesc, poolWaitCountDesc, poolWaitDurationDesc, poolClosedDesc} {
+		ch <- desc
+	}
+}
+
+// Collect sends the current statistics of the pool
+func (c poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.pool.PoolStats()
+	ch <- prometheus.MustNewConstMetric(poolMaxOpenDesc, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(poolOpenDesc, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(poolInUseDesc, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(poolIdleDesc, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(poolWaitCountDesc, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(poolWaitDurationDesc, prometheus.CounterValue, stats.WaitDurationSeconds)
+	ch <- prometheus.MustNewConstMetric(poolClosedDesc, prometheus.CounterValue, float64(stats.MaxIdleClosed), "max_idle")
+	ch <- prometheus.MustNewConstMetric(poolClosedDesc, prometheus.CounterValue, float64(stats.MaxIdleTimeClosed), "max_idle_time")
+	ch <- prometheus.MustNewConstMetric(poolClosedDesc, prometheus.CounterValue, float64(stats.MaxLifetimeClosed), "max_lifetime")
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"gin_CRUD_server/db"
+	"gin_CRUD_server/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	server := newTestServer(t, poolMapOps{db.NewTestMapOps("Map DB Metrics Test")})
+	respRecorder, router := createRouterAndWriter()
+	server.registerRoutes(router)
+	for _, url := range []string{HealthzURL, V1UsersURL + "/" + models.NewUserID(), "/missing/42"} {
+		request, _ := createNewRequest(http.MethodGet, url, "", nil)
+		router.ServeHTTP(respRecorder, request)
+	}
+	_, err := server.DB.GetUserByID(context.Background(), models.NewUserID())
+	assert.Error(t, err)
+
+	respRecorder, router = createRouterAndWriter()
+	server.registerRoutes(router)
+	request, _ := createNewRequest(http.MethodGet, MetricsURL, "", nil)
+	router.ServeHTTP(respRecorder, request)
+	assert.Equal(t, http.StatusOK, respRecorder.Code)
+	body := respRecorder.Body.String()
+	tests := []struct {
+		name   string
+		metric string
+	}{
+		{"Counts the requests by route", `http_requests_total{method="GET",route="/healthz",status="200"} 1`},
+		{"Counts the requests by route pattern", `http_requests_total{method="GET",route="/v1/users/:id",status="401"} 1`},
+		{"Counts the unmatched requests", `http_requests_total{method="GET",route="unmatched",status="404"} 1`},
+		{"Observes the latency of the requests", `http_request_duration_seconds_count{method="GET",route="/healthz"} 1`},
+		{"Gauges the requests in flight", `http_requests_in_flight 1`},
+		{"Observes the duration of the DB operations", `db_operation_duration_seconds_count{operation="GetUserByID"} 1`},
+		{"Counts the DB errors by code", `db_operation_errors_total{code="user_not_found",operation="GetUserByID"} 1`},
+		{"Gauges the connections of the pool", `db_pool_in_use_connections 2`},
+		{"Counts the waits of the pool", `db_pool_wait_count_total 4`},
+		{"Exposes the metrics of the Go runtime", `go_goroutines`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Contains(t, body, tt.metric)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// The actions of the audit entries
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// AuditRedacted replaces the values of the password in the changes of the audit entries
+const AuditRedacted = "REDACTED"
+
+// AuditEntry records who changed the user and how, the entries are never updated or deleted
+// (they are kept when the user is deleted)
+type AuditEntry struct {
+	ID        int64                  `json:"id"`
+	UserID    string                 `json:"user_id"`
+	Action    string                 `json:"action"`
+	ActorID   string                 `json:"actor_id,omitempty"`
+	Changes   map[string]AuditChange `json:"changes"`
+	ClientIP  string                 `json:"client_ip,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// AuditChange is the value of a field of the user before and after the change, the value
+// before a creation and after a deletion is missing
+type AuditChange struct {
+	Old *string `json:"old,omitempty"`
+	New *string `json:"new,omitempty"`
+}
+
+// AuditInfo is who changes the users in the context of a request, the actor is the authenticated
+// user (missing when the user signs up or logs in)
+type AuditInfo struct {
+	ActorID   string
+	ClientIP  string
+	RequestID string
+}
+
+// auditInfoKey is the key of the audit info of the context
+type auditInfoKey struct{}
+
+// WithAuditInfo returns the context carrying the audit info, the DB operations record it in
+// the audit entries of their changes
+func WithAuditInfo(ctx context.Context, info AuditInfo) context.Context {
+	return context.WithValue(ctx, auditInfoKey{}, info)
+}
+
+// AuditInfoFrom returns the audit info of the context, empty when it carries none
+func AuditInfoFrom(ctx context.Context) AuditInfo {
+	info, _ := ctx.Value(auditInfoKey{}).(AuditInfo)
+	return info
+}
+
+// NewAuditEntry returns the audit entry of the change of the user from before to after (nil when the
+// user is created or deleted) by the actor of the context
+func NewAuditEntry(ctx context.Context, action string, before, after *User) AuditEntry {
+	info := AuditInfoFrom(ctx)
+	entry := AuditEntry{
+		Action:    action,
+		ActorID:   info.ActorID,
+		Changes:   UserChanges(before, after),
+		ClientIP:  info.ClientIP,
+		RequestID: info.RequestID,
+		CreatedAt: time.Now(),
+	}
+	if after != nil {
+		entry.UserID = after.ID
+	} else if before != nil {
+		entry.UserID = before.ID
+	}
+	return entry
+}
+
+// UserChanges returns the changed fields of the user (email, name and password), the password
+// hashes are redacted. The updates also record the changed roles as comma-separated lists
+func UserChanges(before, after *User) map[string]AuditChange {
+	fields := []struct {
+		name       string
+		value      func(user *User) string
+		redacted   bool
+		updateOnly bool
+	}{
+		{"email", func(user *User) string { return user.Email }, false, false},
+		{"name", func(user *User) string { return user.Name }, false, false},
+		{"password", func(user *User) string { return user.Password }, true, false},
+		{"roles", func(user *User) string { return strings.Join(user.Roles, ",") }, false, true},
+	}
+	changes := map[string]AuditChange{}
+	for _, field := range fields {
+		if field.updateOnly && (before == nil || after == nil) {
+			continue
+		}
+		if before != nil && after != nil && field.value(before) == field.value(after) {
+			continue
+		}
+		auditValue := func(user *User) *string {
+			if user == nil {
+				return nil
+			}
+			value := field.value(user)
+			if field.redacted {
+				value = AuditRedacted
+			}
+			return &value
+		}
+		changes[field.name] = AuditChange{Old: auditValue(before), New: auditValue(after)}
+	}
+	return changes
+}
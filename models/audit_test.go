@@ -0,0 +1,57 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserChanges(t *testing.T) {
+	user := &User{ID: "1", Email: "bari@gmail.com", Name: "bari", Password: "hash1"}
+	value := func(s string) *string { return &s }
+	tests := []struct {
+		name   string
+		before *User
+		after  *User
+		want   map[string]AuditChange
+	}{
+		{"Records all the fields of the created user", nil, user, map[string]AuditChange{
+			"email":    {New: value("bari@gmail.com")},
+			"name":     {New: value("bari")},
+			"password": {New: value(AuditRedacted)},
+		}},
+		{"Records all the fields of the deleted user", user, nil, map[string]AuditChange{
+			"email":    {Old: value("bari@gmail.com")},
+			"name":     {Old: value("bari")},
+			"password": {Old: value(AuditRedacted)},
+		}},
+		{"Records only the changed name", user, &User{ID: "1", Email: "bari@gmail.com", Name: "bari2", Password: "hash1"}, map[string]AuditChange{
+			"name": {Old: value("bari"), New: value("bari2")},
+		}},
+		{"Records the changed password redacted", user, &User{ID: "1", Email: "bari@gmail.com", Name: "bari", Password: "hash2"}, map[string]AuditChange{
+			"password": {Old: value(AuditRedacted), New: value(AuditRedacted)},
+		}},
+		{"Records the changed roles", user, &User{ID: "1", Email: "bari@gmail.com", Name: "bari", Password: "hash1", Roles: []string{RoleAdmin, RoleMember}}, map[string]AuditChange{
+			"roles": {Old: value(""), New: value("admin,member")},
+		}},
+		{"Records no changes of the unchanged user", user, user, map[string]AuditChange{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, UserChanges(tt.before, tt.after))
+		})
+	}
+}
+
+func TestNewAuditEntry(t *testing.T) {
+	user := &User{ID: "1", Email: "bari@gmail.com", Name: "bari"}
+	ctx := WithAuditInfo(context.Background(), AuditInfo{ActorID: "2", ClientIP: "10.0.0.1", RequestID: "request-1"})
+	entry := NewAuditEntry(ctx, AuditDelete, user, nil)
+	assert.Equal(t, "1", entry.UserID)
+	assert.Equal(t, AuditDelete, entry.Action)
+	assert.Equal(t, "2", entry.ActorID)
+	assert.Equal(t, "10.0.0.1", entry.ClientIP)
+	assert.Equal(t, "request-1", entry.RequestID)
+	assert.Empty(t, NewAuditEntry(context.Background(), AuditCreate, nil, user).ActorID)
+}
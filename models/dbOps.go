@@ -1,9 +1,34 @@
 package models
 
+import "context"
+
+// DBOps are the DB operations, the users are identified by their ID or by their
+// case-insensitive email. Every change of a user increments its version, the updates
+// given a non-zero version return ErrVersionConflict when the user has another version.
+// The operations stop when the context is done, returning ErrTimeout after its deadline
+// and ErrUnavailable when it is canceled
 type DBOps interface {
-	GetAllUsers() ([]User, error)
-	DeleteUser(email string) error
-	InsertNewUser(user User) error
-	UpdateNameAndPassUser(user User) error
-	IsExistsInUsersTable(email string) (*User, error)
+	GetAllUsers(ctx context.Context) ([]User, error)
+	ListUsers(ctx context.Context, opts ListUsersOptions) (*UsersPage, error)
+	SearchUsers(ctx context.Context, query string, limit int) ([]UserSearchResult, error)
+	DeleteUser(ctx context.Context, email string) error
+	DeleteUserByID(ctx context.Context, id string, version int64) error
+	InsertNewUser(ctx context.Context, user User) error
+	UpdateNameAndPassUser(ctx context.Context, user User) error
+	PatchUser(ctx context.Context, id string, patch UserPatch) error
+	IsExistsInUsersTable(ctx context.Context, email string) (*User, error)
+	GetUserByID(ctx context.Context, id string) (*User, error)
+	ChangeEmail(ctx context.Context, id, email string, version int64) error
+	// GetUserAudit gets the audit entries recorded by the changes of the user (creation, updates and
+	// deletion), the DB records them with the AuditInfo of the context of the change
+	GetUserAudit(ctx context.Context, id string) ([]AuditEntry, error)
+
+	GrantRole(ctx context.Context, email, role string) error
+	RevokeRole(ctx context.Context, email, role string) error
+	GetRolesPermissions(ctx context.Context, roles []string) ([]string, error)
+
+	InsertRefreshToken(ctx context.Context, token RefreshToken) error
+	GetRefreshToken(ctx context.Context, hash string) (*RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, hash string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID string) error
 }
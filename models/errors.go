@@ -0,0 +1,141 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The kinds of the errors, they are matched by errors.Is regardless of the code
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+	ErrConflict      = errors.New("conflict")
+	ErrInvalid       = errors.New("invalid")
+	ErrTimeout       = errors.New("timeout")
+	ErrUnavailable   = errors.New("unavailable")
+)
+
+// The error codes are stable and identify the problem for the clients
+const (
+	CodeInvalidRequest        = "invalid_request"
+	CodeValidationFailed      = "validation_failed"
+	CodeInvalidCursor         = "invalid_cursor"
+	CodeInvalidPatch          = "invalid_patch"
+	CodePatchTestFailed       = "patch_test_failed"
+	CodeUserNotFound          = "user_not_found"
+	CodeRoleNotFound          = "role_not_found"
+	CodeRoleNotGranted        = "role_not_granted"
+	CodeRefreshTokenNotFound  = "refresh_token_not_found"
+	CodeEmailTaken            = "email_taken"
+	CodeAlreadyExists         = "already_exists"
+	CodeConflict              = "conflict"
+	CodeInvalidValue          = "invalid_value"
+	CodeVersionConflict       = "version_conflict"
+	CodePreconditionFailed    = "precondition_failed"
+	CodeInternal              = "internal_error"
+	CodeTimeout               = "timeout"
+	CodeUnavailable           = "unavailable"
+	CodeUnauthorized          = "unauthorized"
+	CodeInvalidCredentials    = "invalid_credentials"
+	CodeForbidden             = "forbidden"
+	CodeUnsupportedMediaType  = "unsupported_media_type"
+	CodeNotImplemented        = "not_implemented"
+	CodeFieldRequired         = "required"
+	CodeFieldInvalid          = "invalid"
+	CodeFieldReadOnly         = "read_only"
+	CodeFieldUnknown          = "unknown"
+	CodeFieldOutOfRange       = "out_of_range"
+	CodeFieldUnsupportedValue = "unsupported_value"
+)
+
+// codeKinds are the kinds of the error codes
+var codeKinds = map[string]error{
+	CodeValidationFailed:     ErrInvalid,
+	CodeInvalidCursor:        ErrInvalid,
+	CodeInvalidPatch:         ErrInvalid,
+	CodeInvalidValue:         ErrInvalid,
+	CodeRoleNotFound:         ErrInvalid,
+	CodeUserNotFound:         ErrNotFound,
+	CodeRoleNotGranted:       ErrNotFound,
+	CodeRefreshTokenNotFound: ErrNotFound,
+	CodeEmailTaken:           ErrAlreadyExists,
+	CodeAlreadyExists:        ErrAlreadyExists,
+	CodeConflict:             ErrConflict,
+	CodeVersionConflict:      ErrConflict,
+	CodePatchTestFailed:      ErrConflict,
+	CodeTimeout:              ErrTimeout,
+	CodeUnavailable:          ErrUnavailable,
+}
+
+var (
+	ErrUserNotFound         = NewError(CodeUserNotFound, "the user doesn't exist")
+	ErrRoleNotGranted       = NewError(CodeRoleNotGranted, "the user doesn't have the role")
+	ErrRefreshTokenNotFound = NewError(CodeRefreshTokenNotFound, "the refresh token doesn't exist or is revoked")
+	ErrEmailTaken           = NewError(CodeEmailTaken, "the email is already used by another user")
+	ErrVersionConflict      = NewError(CodeVersionConflict, "the user was modified by another request")
+	ErrInvalidCursor        = NewError(CodeInvalidCursor, "the after cursor is invalid for the requested sort & order")
+	ErrInvalidPatch         = NewError(CodeInvalidPatch, "invalid patch")
+	ErrPatchTestFailed      = NewError(CodePatchTestFailed, "patch test failed")
+)
+
+// FieldError is the validation error of a field of the request
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is the error of the DB operations and the request validations, its code identifies the problem
+// and its kind (ErrNotFound, ErrInvalid...) lets the handlers translate it to the status of the response
+type Error struct {
+	Code   string
+	Kind   error
+	Detail string
+	Fields []FieldError
+	Err    error
+}
+
+// NewError returns a new error of the code with the formatted detail
+func NewError(code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Kind: codeKinds[code], Detail: fmt.Sprintf(format, args...)}
+}
+
+// NewValidationError returns the error of the invalid fields of the request
+func NewValidationError(fields ...FieldError) *Error {
+	err := NewError(CodeValidationFailed, "the request has invalid fields")
+	err.Fields = fields
+	return err
+}
+
+// Wrap returns a copy of the error wrapping the cause
+func (e *Error) Wrap(err error) *Error {
+	wrapped := *e
+	wrapped.Err = err
+	return &wrapped
+}
+
+// Error returns the detail of the error and of the wrapped error
+func (e *Error) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = e.Code
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the wrapped error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is the kind of the error or an error of the same code,
+// so errors.Is matches the sentinel errors regardless of the detail
+func (e *Error) Is(target error) bool {
+	if t, ok := target.(*Error); ok {
+		return t.Code == e.Code
+	}
+	return e.Kind != nil && target == e.Kind
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError_Is(t *testing.T) {
+	cause := errors.New("duplicate key")
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{"Matches the kind of the code", ErrUserNotFound, ErrNotFound, true},
+		{"Matches the sentinel of the code", NewError(CodeEmailTaken, "taken"), ErrEmailTaken, true},
+		{"Matches the sentinel of a wrapped error", fmt.Errorf("insert: %w", ErrEmailTaken.Wrap(cause)), ErrEmailTaken, true},
+		{"Matches the cause of a wrapped error", ErrEmailTaken.Wrap(cause), cause, true},
+		{"Matches the kind of a validation error", NewValidationError(), ErrInvalid, true},
+		{"Doesn't match another kind", ErrVersionConflict, ErrNotFound, false},
+		{"Doesn't match another code of the same kind", ErrVersionConflict, ErrPatchTestFailed, false},
+		{"Doesn't match the kind of an error without kind", NewError(CodeInternal, "failed"), ErrInvalid, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, errors.Is(tt.err, tt.target))
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+const (
+	SortByEmail     = "email"
+	SortByUsername  = "username"
+	SortByCreatedAt = "created_at"
+
+	DefaultListLimit = 50
+	MaxListLimit     = 200
+)
+
+// ListUsersOptions are the pagination, sorting and filtering options of the users list
+type ListUsersOptions struct {
+	Limit         int
+	After         string
+	SortBy        string
+	Desc          bool
+	NameContains  string
+	CreatedBefore *time.Time
+	CreatedAfter  *time.Time
+}
+
+// UsersPage is a page of the users list, NextCursor is empty on the last page
+type UsersPage struct {
+	Users      []User `json:"users"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// UsersCursor is the position of the last user of a page (keyset pagination), the email
+// breaks ties between users with the same sort value
+type UsersCursor struct {
+	SortBy string `json:"s"`
+	Desc   bool   `json:"d"`
+	Value  string `json:"v"`
+	Email  string `json:"e"`
+}
+
+// NewListUsersOptions returns the default options (sorted by email descending)
+func NewListUsersOptions() ListUsersOptions {
+	return ListUsersOptions{Limit: DefaultListLimit, SortBy: SortByEmail, Desc: true}
+}
+
+// IsValidSortBy reports whether the users list can be sorted by the field
+func IsValidSortBy(sortBy string) bool {
+	return sortBy == SortByEmail || sortBy == SortByUsername || sortBy == SortByCreatedAt
+}
+
+// SortValue returns the value of the user according to the sort field, usernames are case-insensitive
+func (user User) SortValue(sortBy string) string {
+	switch sortBy {
+	case SortByUsername:
+		return strings.ToLower(user.Name)
+	case SortByCreatedAt:
+		return user.CreatedAt
+	}
+	return user.Email
+}
+
+// Cursor returns the cursor of the options after the user
+func (opts ListUsersOptions) Cursor(user User) string {
+	buf, _ := json.Marshal(UsersCursor{SortBy: opts.SortBy, Desc: opts.Desc, Value: user.SortValue(opts.SortBy), Email: user.Email})
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// DecodeCursor returns the cursor of After or nil on the first page, the cursor
+// must have been created with the same sort field and direction
+func (opts ListUsersOptions) DecodeCursor() (*UsersCursor, error) {
+	if opts.After == "" {
+		return nil, nil
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(opts.After)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	cursor := UsersCursor{}
+	if err = json.Unmarshal(buf, &cursor); err != nil || cursor.SortBy != opts.SortBy || cursor.Desc != opts.Desc {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// Matches reports whether the user matches the filters of the options
+func (opts ListUsersOptions) Matches(user User) bool {
+	if opts.NameContains != "" && !strings.Contains(strings.ToLower(user.Name), strings.ToLower(opts.NameContains)) {
+		return false
+	}
+	if opts.CreatedBefore != nil || opts.CreatedAfter != nil {
+		createdAt, err := time.Parse(time.RFC3339Nano, user.CreatedAt)
+		if err != nil {
+			return false
+		}
+		if opts.CreatedBefore != nil && !createdAt.Before(*opts.CreatedBefore) {
+			return false
+		}
+		if opts.CreatedAfter != nil && !createdAt.After(*opts.CreatedAfter) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// RefreshToken is a persisted refresh token, only the hash of the token is stored
+type RefreshToken struct {
+	Hash      string
+	UserID    string
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// NewRefreshToken returns a new refresh token
+func NewRefreshToken(hash, userID string, expiresAt time.Time) *RefreshToken {
+	return &RefreshToken{Hash: hash, UserID: userID, ExpiresAt: expiresAt, CreatedAt: time.Now()}
+}
+
+// IsActive reports whether the refresh token isn't revoked or expired
+func (token RefreshToken) IsActive() bool {
+	return token.RevokedAt == nil && time.Now().Before(token.ExpiresAt)
+}
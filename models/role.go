@@ -0,0 +1,30 @@
+package models
+
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+	RoleMember  = "member"
+
+	PermissionReadUsers   = "users.read"
+	PermissionListUsers   = "users.list"
+	PermissionUpdateUsers = "users.update"
+	PermissionDeleteUsers = "users.delete"
+	PermissionManageRoles = "roles.manage"
+	PermissionReadDBStats = "db.stats"
+	PermissionReadAudit   = "users.audit"
+)
+
+// RolePermissions are the permissions of each role, the same permissions are seeded
+// into the role_permissions table. Users may always access themselves, the permissions
+// allow access to other users
+var RolePermissions = map[string][]string{
+	RoleAdmin:   {PermissionReadUsers, PermissionListUsers, PermissionUpdateUsers, PermissionDeleteUsers, PermissionManageRoles, PermissionReadDBStats, PermissionReadAudit},
+	RoleSupport: {PermissionReadUsers, PermissionListUsers},
+	RoleMember:  {},
+}
+
+// IsValidRole reports whether the role exists
+func IsValidRole(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
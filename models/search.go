@@ -0,0 +1,82 @@
+package models
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+
+	HighlightStart = "<mark>"
+	HighlightEnd   = "</mark>"
+)
+
+// UserSearchResult is a user matching the search query, ranked by relevance.
+// The highlights hold the HTML escaped email & name with the matched terms marked
+type UserSearchResult struct {
+	User       User              `json:"user"`
+	Rank       float64           `json:"rank"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// SearchTerms returns the lowercase words (letters & digits) of the search query
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// NewUserSearchResult returns the search result of the user with the highlights of the terms
+func NewUserSearchResult(user User, rank float64, terms []string) UserSearchResult {
+	return UserSearchResult{
+		User: user.WithoutPassword(),
+		Rank: rank,
+		Highlights: map[string]string{
+			"email": Highlight(user.Email, terms),
+			"name":  Highlight(user.Name, terms),
+		},
+	}
+}
+
+// Highlight returns the HTML escaped text with the case-insensitive occurrences of the terms marked
+func Highlight(text string, terms []string) string {
+	lower := []rune(strings.ToLower(text))
+	runes := []rune(text)
+	if len(lower) != len(runes) {
+		return html.EscapeString(text)
+	}
+	// Finds the matched ranges and merges the overlapping ones
+	var ranges [][2]int
+	for _, term := range terms {
+		needle := []rune(term)
+		for i := 0; len(needle) > 0 && i+len(needle) <= len(lower); i++ {
+			if string(lower[i:i+len(needle)]) == term {
+				ranges = append(ranges, [2]int{i, i + len(needle)})
+			}
+		}
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	var builder strings.Builder
+	pos := 0
+	for i := 0; i < len(ranges); i++ {
+		start, end := ranges[i][0], ranges[i][1]
+		for i+1 < len(ranges) && ranges[i+1][0] <= end {
+			if ranges[i+1][1] > end {
+				end = ranges[i+1][1]
+			}
+			i++
+		}
+		if start < pos {
+			start = pos
+		}
+		builder.WriteString(html.EscapeString(string(runes[pos:start])))
+		builder.WriteString(HighlightStart + html.EscapeString(string(runes[start:end])) + HighlightEnd)
+		pos = end
+	}
+	builder.WriteString(html.EscapeString(string(runes[pos:])))
+	return builder.String()
+}
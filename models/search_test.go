@@ -0,0 +1,32 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		terms []string
+		want  string
+	}{
+		{"Highlights a case-insensitive match", "Bari Arviv", []string{"bari"}, "<mark>Bari</mark> Arviv"},
+		{"Highlights several terms", "bari@gmail.com", []string{"bari", "gmail"}, "<mark>bari</mark>@<mark>gmail</mark>.com"},
+		{"Merges overlapping matches", "barbari", []string{"bar", "arb"}, "<mark>barbar</mark>i"},
+		{"Escapes the HTML of the text", "<b>bari</b>", []string{"bari"}, "&lt;b&gt;<mark>bari</mark>&lt;/b&gt;"},
+		{"Returns the text without matches", "avi", []string{"bari"}, "avi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Highlight(tt.text, tt.terms))
+		})
+	}
+}
+
+func TestSearchTerms(t *testing.T) {
+	assert.Equal(t, []string{"bari", "gmail", "com"}, SearchTerms(" Bari@Gmail.com "))
+	assert.Empty(t, SearchTerms("&|!:*"))
+}
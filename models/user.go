@@ -1,15 +1,48 @@
 package models
 
-import "time"
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type User struct {
-	Email     string `json:"email"`
-	Name      string `json:"name"`
-	Password  string `json:"password"`
-	CreatedAt string `json:"created_at"`
+	ID        string   `json:"id"`
+	Email     string   `json:"email"`
+	Name      string   `json:"name"`
+	Password  string   `json:"password,omitempty"`
+	CreatedAt string   `json:"created_at"`
+	UpdatedAt string   `json:"updated_at"`
+	Version   int64    `json:"version"`
+	Roles     []string `json:"roles,omitempty"`
 }
 
 // NewUser returns a new user
 func NewUser(email, name, password string) *User {
-	return &User{Email: email, Name: name, Password: password, CreatedAt: time.Now().String()}
+	now := time.Now().Format(time.RFC3339Nano)
+	return &User{ID: NewUserID(), Email: email, Name: name, Password: password, CreatedAt: now, UpdatedAt: now, Version: 1}
+}
+
+// NewUserID returns a new time-ordered user ID (UUIDv7)
+func NewUserID() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
+
+// IsUserID reports whether the string is a user ID and not an email
+func IsUserID(id string) bool {
+	_, err := uuid.Parse(id)
+	return err == nil && !strings.Contains(id, "@")
+}
+
+// ETag returns the strong entity tag of the user, it changes with every version of the user
+func (user User) ETag() string {
+	return `"` + strconv.FormatInt(user.Version, 10) + `"`
+}
+
+// WithoutPassword returns a copy of the user without the password hash
+func (user User) WithoutPassword() User {
+	user.Password = ""
+	return user
 }
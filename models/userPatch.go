@@ -0,0 +1,156 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+// UserPatch are the changes of a partial update, the nil fields are kept. A non-zero
+// Version is the version the user must still have for the patch to be applied
+type UserPatch struct {
+	Name     *string
+	Password *string
+	Version  int64
+}
+
+// IsEmpty reports whether the patch doesn't change anything
+func (patch UserPatch) IsEmpty() bool {
+	return patch.Name == nil && patch.Password == nil
+}
+
+// NewMergePatch parses a JSON merge patch (RFC 7396) of the user, only the name and password
+// can be changed and they cannot be removed by a null value
+func NewMergePatch(user User, doc []byte) (*UserPatch, error) {
+	patch := &UserPatch{}
+	members := map[string]json.RawMessage{}
+	if err := json.Unmarshal(doc, &members); err != nil {
+		return patch, NewError(CodeInvalidPatch, "the merge patch must be a JSON object")
+	}
+	for member, value := range members {
+		switch member {
+		case "name":
+			patch.Name = new(string)
+			if err := decodePatchValue(member, value, patch.Name); err != nil {
+				return patch, err
+			}
+		case "password":
+			patch.Password = new(string)
+			if err := decodePatchValue(member, value, patch.Password); err != nil {
+				return patch, err
+			}
+		default:
+			if err := checkReadOnly(user, member, value); err != nil {
+				return patch, err
+			}
+		}
+	}
+	return patch, nil
+}
+
+// JSONPatchOperation is an operation of a JSON patch
+type JSONPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// NewJSONPatch parses a JSON patch (RFC 6902) of the user, the name and password can be
+// added or replaced and the other fields can only be tested. The operations are applied
+// in order and the patch fails as a whole when one of them fails
+func NewJSONPatch(user User, doc []byte) (*UserPatch, error) {
+	patch := &UserPatch{}
+	var operations []JSONPatchOperation
+	if err := json.Unmarshal(doc, &operations); err != nil {
+		return patch, NewError(CodeInvalidPatch, "the JSON patch must be an array of operations")
+	}
+	for i, operation := range operations {
+		member := strings.TrimPrefix(operation.Path, "/")
+		if !strings.HasPrefix(operation.Path, "/") || strings.Contains(member, "/") {
+			return patch, NewError(CodeInvalidPatch, "operation %d has the invalid path %q", i, operation.Path)
+		}
+		switch operation.Op {
+		case "add", "replace":
+			var field **string
+			switch member {
+			case "name":
+				field = &patch.Name
+			case "password":
+				field = &patch.Password
+			default:
+				return patch, NewError(CodeInvalidPatch, "%q cannot be changed", member)
+			}
+			*field = new(string)
+			if err := decodePatchValue(member, operation.Value, *field); err != nil {
+				return patch, err
+			}
+			if member == "name" {
+				user.Name = **field
+			}
+		case "test":
+			if member == "password" {
+				return patch, NewError(CodeInvalidPatch, "%q cannot be tested", member)
+			}
+			current, ok := patchableValues(user)[member]
+			if !ok {
+				return patch, NewError(CodeInvalidPatch, "%q doesn't exist", member)
+			}
+			var value string
+			if err := json.Unmarshal(operation.Value, &value); err != nil || value != current {
+				return patch, NewError(CodePatchTestFailed, "%q isn't %s", member, operation.Value)
+			}
+		case "remove", "move", "copy":
+			return patch, NewError(CodeInvalidPatch, "the %q operation isn't supported", operation.Op)
+		default:
+			return patch, NewError(CodeInvalidPatch, "unknown operation %q", operation.Op)
+		}
+	}
+	return patch, nil
+}
+
+// decodePatchValue decodes the new value of the member, which must be a non-empty string
+func decodePatchValue(member string, value json.RawMessage, dest *string) error {
+	if len(value) == 0 || bytes.Equal(value, []byte("null")) {
+		return NewError(CodeInvalidPatch, "%q cannot be removed", member)
+	}
+	if err := json.Unmarshal(value, dest); err != nil || *dest == "" {
+		return NewError(CodeInvalidPatch, "%q must be a non-empty string", member)
+	}
+	return nil
+}
+
+// checkReadOnly returns an error unless the member is a read-only field of the user
+// set to its current value (so a client may send back the user it got)
+func checkReadOnly(user User, member string, value json.RawMessage) error {
+	if member == "roles" {
+		var roles []string
+		if err := json.Unmarshal(value, &roles); err != nil || strings.Join(roles, ",") != strings.Join(user.Roles, ",") {
+			return NewError(CodeInvalidPatch, "%q cannot be changed by a patch", member)
+		}
+		return nil
+	}
+	current, ok := patchableValues(user)[member]
+	if !ok {
+		return NewError(CodeInvalidPatch, "%q cannot be changed", member)
+	}
+	var newValue string
+	if err := json.Unmarshal(value, &newValue); err != nil || !strings.EqualFold(newValue, current) {
+		return NewError(CodeInvalidPatch, "%q cannot be changed by a patch", member)
+	}
+	return nil
+}
+
+// patchableValues returns the string fields of the user a patch may refer to
+func patchableValues(user User) map[string]string {
+	return map[string]string{
+		"id":         user.ID,
+		"email":      user.Email,
+		"name":       user.Name,
+		"created_at": user.CreatedAt,
+	}
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMergePatch(t *testing.T) {
+	user := User{ID: "1", Email: "bari@gmail.com", Name: "bari", Roles: []string{RoleMember}}
+	name, password := "bari2", "1234"
+	tests := []struct {
+		name    string
+		doc     string
+		want    UserPatch
+		wantErr error
+	}{
+		{"Patches only the name", `{"name": "bari2"}`, UserPatch{Name: &name}, nil},
+		{"Patches the name and password", `{"name": "bari2", "password": "1234"}`, UserPatch{Name: &name, Password: &password}, nil},
+		{"Ignores the unchanged read-only fields", `{"id": "1", "email": "Bari@gmail.com", "roles": ["member"]}`, UserPatch{}, nil},
+		{"Fails due to removing the name", `{"name": null}`, UserPatch{}, ErrInvalidPatch},
+		{"Fails due to empty password", `{"password": ""}`, UserPatch{}, ErrInvalidPatch},
+		{"Fails due to changing the email", `{"email": "a@gmail.com"}`, UserPatch{}, ErrInvalidPatch},
+		{"Fails due to changing the roles", `{"roles": ["admin"]}`, UserPatch{}, ErrInvalidPatch},
+		{"Fails due to unknown field", `{"age": 3}`, UserPatch{}, ErrInvalidPatch},
+		{"Fails due to non-object patch", `["name"]`, UserPatch{}, ErrInvalidPatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := NewMergePatch(user, []byte(tt.doc))
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr == nil {
+				assert.Equal(t, tt.want, *patch)
+			}
+		})
+	}
+}
+
+func TestNewJSONPatch(t *testing.T) {
+	user := User{ID: "1", Email: "bari@gmail.com", Name: "bari"}
+	name, password := "bari2", "1234"
+	tests := []struct {
+		name    string
+		doc     string
+		want    UserPatch
+		wantErr error
+	}{
+		{"Replaces the name", `[{"op": "replace", "path": "/name", "value": "bari2"}]`, UserPatch{Name: &name}, nil},
+		{"Tests the name and replaces the password", `[{"op": "test", "path": "/name", "value": "bari"}, {"op": "add", "path": "/password", "value": "1234"}]`, UserPatch{Password: &password}, nil},
+		{"Tests the replaced name", `[{"op": "replace", "path": "/name", "value": "bari2"}, {"op": "test", "path": "/name", "value": "bari2"}]`, UserPatch{Name: &name}, nil},
+		{"Fails due to failed test", `[{"op": "test", "path": "/email", "value": "a@gmail.com"}, {"op": "replace", "path": "/name", "value": "bari2"}]`, UserPatch{}, ErrPatchTestFailed},
+		{"Fails due to testing the password", `[{"op": "test", "path": "/password", "value": "1234"}]`, UserPatch{}, ErrInvalidPatch},
+		{"Fails due to replacing the email", `[{"op": "replace", "path": "/email", "value": "a@gmail.com"}]`, UserPatch{}, ErrInvalidPatch},
+		{"Fails due to removing the name", `[{"op": "remove", "path": "/name"}]`, UserPatch{}, ErrInvalidPatch},
+		{"Fails due to invalid path", `[{"op": "replace", "path": "name", "value": "bari2"}]`, UserPatch{}, ErrInvalidPatch},
+		{"Fails due to unknown operation", `[{"op": "swap", "path": "/name", "value": "bari2"}]`, UserPatch{}, ErrInvalidPatch},
+		{"Fails due to non-array patch", `{"name": "bari2"}`, UserPatch{}, ErrInvalidPatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := NewJSONPatch(user, []byte(tt.doc))
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr == nil {
+				assert.Equal(t, tt.want, *patch)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"gin_CRUD_server/models"
+	"github.com/gin-gonic/gin"
+)
+
+// checkPreconditions sets the ETag of the user and evaluates the If-Match and If-None-Match
+// headers against it. When a precondition fails it responds with 304 Not Modified (GET & HEAD)
+// or 412 Precondition Failed and returns false, otherwise it returns the version the change
+// must be applied to (0 without If-Match, the change is then unconditional)
+func checkPreconditions(ctx *gin.Context, user *models.User) (int64, bool) {
+	etag := user.ETag()
+	ctx.Header("ETag", etag)
+	var version int64
+	if ifMatch := ctx.GetHeader("If-Match"); ifMatch != "" {
+		if !etagMatches(ifMatch, etag, false) {
+			abortWithProblem(ctx, models.CodeVersionConflict, "the user doesn't match If-Match, it was modified by another request")
+			return version, false
+		}
+		version = user.Version
+	}
+	if ifNoneMatch := ctx.GetHeader("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag, true) {
+		if ctx.Request.Method == http.MethodGet || ctx.Request.Method == http.MethodHead {
+			ctx.Status(http.StatusNotModified)
+		} else {
+			abortWithProblem(ctx, models.CodePreconditionFailed, "the user matches If-None-Match")
+		}
+		return version, false
+	}
+	return version, true
+}
+
+// etagMatches reports whether the comma-separated entity tags of the header (or "*") match the
+// entity tag, the weak comparison ignores the W/ prefix and the strong comparison never matches it
+func etagMatches(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
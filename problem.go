@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"gin_CRUD_server/logging"
+	"gin_CRUD_server/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	RequestIDHeader    = "X-Request-ID"
+	RequestIDKey       = "requestID"
+	ProblemContentType = "application/problem+json"
+	ProblemTypePrefix  = "urn:gin-crud-server:problem:"
+
+	maxRequestIDLength = 128
+)
+
+// RequestIDAttribute is the attribute of the server span holding the ID of the request
+const RequestIDAttribute = attribute.Key("http.request_id")
+
+// Problem is the body of the error responses (RFC 7807 problem details), the code is the
+// stable identifier of the problem and the errors are the invalid fields of the request
+type Problem struct {
+	Type      string              `json:"type"`
+	Title     string              `json:"title"`
+	Status    int                 `json:"status"`
+	Detail    string              `json:"detail,omitempty"`
+	Instance  string              `json:"instance,omitempty"`
+	Code      string              `json:"code"`
+	RequestID string              `json:"request_id,omitempty"`
+	Errors    []models.FieldError `json:"errors,omitempty"`
+}
+
+// problemType is the status and title of the responses of an error code, a zero status
+// is the status of the kind of the error
+type problemType struct {
+	status int
+	title  string
+}
+
+// problemTypes are the problem types of the error codes
+var problemTypes = map[string]problemType{
+	models.CodeInvalidRequest:       {http.StatusBadRequest, "Invalid request"},
+	models.CodeValidationFailed:     {0, "Validation failed"},
+	models.CodeInvalidCursor:        {0, "Invalid cursor"},
+	models.CodeInvalidPatch:         {0, "Invalid patch"},
+	models.CodeInvalidValue:         {0, "Invalid value"},
+	models.CodeRoleNotFound:         {0, "Role not found"},
+	models.CodeUnauthorized:         {http.StatusUnauthorized, "Unauthorized"},
+	models.CodeInvalidCredentials:   {http.StatusUnauthorized, "Invalid credentials"},
+	models.CodeRefreshTokenNotFound: {http.StatusUnauthorized, "Invalid refresh token"},
+	models.CodeForbidden:            {http.StatusForbidden, "Forbidden"},
+	models.CodeUserNotFound:         {0, "User not found"},
+	models.CodeRoleNotGranted:       {0, "Role not granted"},
+	models.CodeEmailTaken:           {0, "Email already used"},
+	models.CodeAlreadyExists:        {0, "Already exists"},
+	models.CodeConflict:             {0, "Conflict"},
+	models.CodePatchTestFailed:      {0, "Patch test failed"},
+	models.CodeVersionConflict:      {http.StatusPreconditionFailed, "Version conflict"},
+	models.CodePreconditionFailed:   {http.StatusPreconditionFailed, "Precondition failed"},
+	models.CodeUnsupportedMediaType: {http.StatusUnsupportedMediaType, "Unsupported media type"},
+	models.CodeNotImplemented:       {http.StatusNotImplemented, "Not implemented"},
+	models.CodeInternal:             {http.StatusInternalServerError, "Internal server error"},
+	models.CodeTimeout:              {0, "Timeout"},
+	models.CodeUnavailable:          {0, "Service unavailable"},
+}
+
+// kindStatuses are the statuses of the kinds of the errors
+var kindStatuses = map[error]int{
+	models.ErrNotFound:      http.StatusNotFound,
+	models.ErrAlreadyExists: http.StatusConflict,
+	models.ErrConflict:      http.StatusConflict,
+	models.ErrInvalid:       http.StatusUnprocessableEntity,
+	models.ErrTimeout:       http.StatusGatewayTimeout,
+	models.ErrUnavailable:   http.StatusServiceUnavailable,
+}
+
+// problemTypeOf returns the problem type of the error, the unknown codes are internal errors
+func problemTypeOf(e *models.Error) problemType {
+	pt, ok := problemTypes[e.Code]
+	if !ok {
+		return problemTypes[models.CodeInternal]
+	}
+	if pt.status == 0 {
+		if pt.status, ok = kindStatuses[e.Kind]; !ok {
+			pt.status = http.StatusInternalServerError
+		}
+	}
+	return pt
+}
+
+// RequestID sets the ID of the request from the X-Request-ID header, or a new ID when the header
+// is missing or invalid, and returns it in the X-Request-ID header of the response. The ID is also
+// set on the span of the request, on the entries of its logger by RequestLogger and on the audit
+// entries of its changes
+func RequestID(ctx *gin.Context) {
+	id := ctx.GetHeader(RequestIDHeader)
+	if !isValidRequestID(id) {
+		id = uuid.NewString()
+	}
+	ctx.Set(RequestIDKey, id)
+	ctx.Header(RequestIDHeader, id)
+	ctx.Request = ctx.Request.WithContext(models.WithAuditInfo(ctx.Request.Context(), models.AuditInfo{ClientIP: ctx.ClientIP(), RequestID: id}))
+	trace.SpanFromContext(ctx.Request.Context()).SetAttributes(RequestIDAttribute.String(id))
+	ctx.Next()
+}
+
+// isValidRequestID reports whether the request ID received from the client can be used,
+// it must be short and printable ASCII so it can be returned and logged safely
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// respondWithError aborts the request with the problem of the error. The errors other than
+// *models.Error are internal errors, they are logged and their detail isn't returned
+func respondWithError(ctx *gin.Context, err error) {
+	var e *models.Error
+	if !errors.As(err, &e) {
+		logging.FromContext(ctx.Request.Context()).Error("Request failed", logging.ErrorKey, err)
+		e = models.NewError(models.CodeInternal, "an unexpected error occurred, please try again later")
+	}
+	pt := problemTypeOf(e)
+	ctx.Header("Content-Type", ProblemContentType)
+	ctx.AbortWithStatusJSON(pt.status, Problem{
+		Type:      ProblemTypePrefix + e.Code,
+		Title:     pt.title,
+		Status:    pt.status,
+		Detail:    e.Detail,
+		Instance:  ctx.Request.URL.Path,
+		Code:      e.Code,
+		RequestID: ctx.GetString(RequestIDKey),
+		Errors:    e.Fields,
+	})
+}
+
+// abortWithProblem aborts the request with the problem of the code and the formatted detail
+func abortWithProblem(ctx *gin.Context, code, format string, args ...interface{}) {
+	respondWithError(ctx, models.NewError(code, format, args...))
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gin_CRUD_server/db"
+	"gin_CRUD_server/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_respondWithError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantDetail string
+	}{
+		{"Responds 404 to a missing user", models.ErrUserNotFound, http.StatusNotFound, models.CodeUserNotFound, "the user doesn't exist"},
+		{"Responds 409 to a wrapped email error", fmt.Errorf("change: %w", models.ErrEmailTaken), http.StatusConflict, models.CodeEmailTaken, models.ErrEmailTaken.Detail},
+		{"Responds 412 to a version conflict", models.ErrVersionConflict, http.StatusPreconditionFailed, models.CodeVersionConflict, models.ErrVersionConflict.Detail},
+		{"Responds 500 without the detail of an unknown error", fmt.Errorf("pq: password authentication failed"), http.StatusInternalServerError, models.CodeInternal, "an unexpected error occurred, please try again later"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			respRecorder := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(respRecorder)
+			ctx.Request = httptest.NewRequest(http.MethodGet, URL, nil)
+			ctx.Set(RequestIDKey, "abc")
+			respondWithError(ctx, tt.err)
+			assert.Equal(t, tt.wantStatus, respRecorder.Code)
+			assert.Equal(t, ProblemContentType, respRecorder.Header().Get("Content-Type"))
+			problem := Problem{}
+			assert.NoError(t, json.Unmarshal(respRecorder.Body.Bytes(), &problem))
+			assert.Equal(t, Problem{
+				Type:      ProblemTypePrefix + tt.wantCode,
+				Title:     problemTypes[tt.wantCode].title,
+				Status:    tt.wantStatus,
+				Detail:    tt.wantDetail,
+				Instance:  URL,
+				Code:      tt.wantCode,
+				RequestID: "abc",
+			}, problem)
+		})
+	}
+}
+
+func TestProblemResponses(t *testing.T) {
+	server := newTestServer(t, MapDB)
+	tests := []struct {
+		name          string
+		method        string
+		url           string
+		body          string
+		requestID     string
+		wantStatus    int
+		wantCode      string
+		wantFields    []string
+		wantRequestID bool
+	}{
+		{"Returns the fields of a validation error", http.MethodPut, URL, `{"email": "bari@gmail.com"}`, "", http.StatusUnprocessableEntity, models.CodeValidationFailed, []string{"name", "password"}, false},
+		{"Returns an invalid request due to malformed JSON", http.MethodPut, URL, `{"email": `, "", http.StatusBadRequest, models.CodeInvalidRequest, nil, false},
+		{"Returns unauthorized due to missing token", http.MethodGet, V1UsersURL, "", "", http.StatusUnauthorized, models.CodeUnauthorized, nil, false},
+		{"Returns the request ID of the client", http.MethodPost, LoginURL, `{"email": "a@gmail.com", "password": "1"}`, "client-id-1", http.StatusUnauthorized, models.CodeInvalidCredentials, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			respRecorder, router := createRouterAndWriter()
+			server.registerRoutes(router)
+			request := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			request.Header.Set(ContentType, "application/json")
+			if tt.requestID != "" {
+				request.Header.Set(RequestIDHeader, tt.requestID)
+			}
+			router.ServeHTTP(respRecorder, request)
+			assert.Equal(t, tt.wantStatus, respRecorder.Code)
+			problem := Problem{}
+			assert.NoError(t, json.Unmarshal(respRecorder.Body.Bytes(), &problem))
+			assert.Equal(t, tt.wantCode, problem.Code)
+			var fields []string
+			for _, field := range problem.Errors {
+				fields = append(fields, field.Field)
+			}
+			assert.Equal(t, tt.wantFields, fields)
+			assert.NotEmpty(t, problem.RequestID)
+			assert.Equal(t, problem.RequestID, respRecorder.Header().Get(RequestIDHeader))
+			if tt.wantRequestID {
+				assert.Equal(t, tt.requestID, problem.RequestID)
+			}
+		})
+	}
+}
+
+func TestDBContextProblems(t *testing.T) {
+	server := newTestServer(t, db.NewTestMapOps("Map DB Context Test"))
+	user := models.NewUser(TestEmail, "bari", "1234")
+	server.DB.InsertNewUser(context.Background(), *user)
+	token, _, _ := server.Tokens.NewAccessToken(user.ID, nil)
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		wantStatus int
+		wantCode   string
+	}{
+		{"Gets the user successfully", context.Background(), http.StatusOK, ""},
+		{"Returns service unavailable due to the canceled request", canceled, http.StatusServiceUnavailable, models.CodeUnavailable},
+		{"Returns gateway timeout due to the exceeded deadline", expired, http.StatusGatewayTimeout, models.CodeTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			respRecorder, router := createRouterAndWriter()
+			server.registerRoutes(router)
+			request := httptest.NewRequest(http.MethodGet, V1UsersURL+"/"+user.ID, nil).WithContext(tt.ctx)
+			request.Header.Set("Authorization", BearerPrefix+token)
+			router.ServeHTTP(respRecorder, request)
+			assert.Equal(t, tt.wantStatus, respRecorder.Code)
+			if tt.wantCode != "" {
+				problem := Problem{}
+				assert.NoError(t, json.Unmarshal(respRecorder.Body.Bytes(), &problem))
+				assert.Equal(t, tt.wantCode, problem.Code)
+			}
+		})
+	}
+}
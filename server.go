@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"gin_CRUD_server/auth"
+	"gin_CRUD_server/db"
+	"gin_CRUD_server/logging"
+	"gin_CRUD_server/models"
+	"github.com/gin-gonic/gin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Server holds the router, the DB operations and the config, so that several servers with
+// different DBs can run in the same process
+type Server struct {
+	Config    Config
+	Router    *gin.Engine
+	DB        models.DBOps
+	Passwords *auth.Passwords
+	Tokens    *auth.TokenIssuer
+	Admins    map[string]bool
+	Metrics   *Metrics
+	// Logger is the JSON logger of the server, each request has its own logger with the ID of the request
+	Logger *slog.Logger
+	// TracerProvider creates the spans of the requests and of their DB queries
+	TracerProvider *sdktrace.TracerProvider
+
+	// draining is set when the server is shutting down
+	draining int32
+}
+
+// NewServer returns a new server using the DB operations, its routes are registered on its router and
+// the DB operations are instrumented with its metrics
+func NewServer(config Config, dbOps models.DBOps) (*Server, error) {
+	level, err := logging.ParseLevel(config.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	logger := logging.New(os.Stdout, level)
+	passwords, err := newPasswords(config.PasswordHashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := newTokenIssuer(logger, config.JWTSigningMethod, config.JWTSecrets, config.JWTPrivateKeyFiles)
+	if err != nil {
+		return nil, err
+	}
+	tracerProvider, err := newTracerProvider(config.TracingExporter, config.TracingEndpoint, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	router := gin.New()
+	if err = router.SetTrustedProxies(trustedProxies(config.TrustedProxies)); err != nil {
+		return nil, fmt.Errorf("Invalid trusted proxies %q: %s\n", config.TrustedProxies, err)
+	}
+	metrics := NewMetrics()
+	if pool, ok := dbOps.(db.PoolStatsProvider); ok {
+		metrics.RegisterPool(pool)
+	}
+	s := &Server{
+		Config:    config,
+		Router:    router,
+		DB:        db.NewInstrumentedOps(dbOps, metrics.ObserveDB),
+		Passwords: passwords,
+		Tokens:    tokens,
+		Admins:    newAdmins(config.AdminEmails),
+		Metrics:   metrics,
+		Logger:    logger,
+
+		TracerProvider: tracerProvider,
+	}
+	s.registerRoutes(s.Router)
+	return s, nil
+}
+
+// trustedProxies returns the comma-separated IPs and CIDRs of the trusted proxies, none by default
+// so the X-Forwarded-For header of the clients can't spoof their IP
+func trustedProxies(list string) []string {
+	var proxies []string
+	for _, proxy := range strings.Split(list, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// Run starts the server with https/ssl enabled on the port of the config until the context is done,
+// then it shuts down gracefully
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := createTLSCert(s.Config.CertFile, s.Config.KeyFile, s.Config.Port)
+	if err != nil || ln == nil {
+		return err
+	}
+	return s.Serve(ctx, *ln)
+}
+
+// Serve serves the requests of the listener until the context is done, then the server becomes not
+// ready and keeps serving during the ShutdownDelay so the load balancers stop sending it new requests,
+// and the in-flight requests are drained during the DrainTimeout before their connections are closed
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	httpServer := &http.Server{Handler: s.Router}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- httpServer.Serve(ln)
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	s.Logger.Info("Shutting down, the server isn't ready", "shutdown_delay", s.Config.ShutdownDelay)
+	s.StartDraining()
+	time.Sleep(s.Config.ShutdownDelay)
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), s.Config.DrainTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(drainCtx); err != nil {
+		s.Logger.Error("Cannot drain the requests", "drain_timeout", s.Config.DrainTimeout, logging.ErrorKey, err)
+		return httpServer.Close()
+	}
+	s.Logger.Info("The requests are drained")
+	return nil
+}
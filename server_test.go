@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gin_CRUD_server/db"
+	"gin_CRUD_server/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"Creates a server with the default config successfully", Config{}, false},
+		{"Creates a server with bcrypt & rotated secrets successfully", Config{PasswordHashAlgorithm: "bcrypt", JWTSecrets: "old,new"}, false},
+		{"Creates fail due to unsupported password hash algorithm", Config{PasswordHashAlgorithm: "md5"}, true},
+		{"Creates fail due to unsupported JWT signing method", Config{JWTSigningMethod: "none"}, true},
+		{"Creates fail due to missing private key file", Config{JWTSigningMethod: "RS256", JWTPrivateKeyFiles: "missing.pem"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewServer(tt.config, db.NewTestMapOps("Map DB Server Test")); (err != nil) != tt.wantErr {
+				t.Errorf("NewServer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServers_Isolated(t *testing.T) {
+	// Two servers in the same process don't share their DB, tokens or admins
+	first := newTestServer(t, db.NewTestMapOps("Map DB First Server"))
+	second, err := NewServer(Config{JWTSecrets: "other", AdminEmails: AdminEmail}, db.NewTestMapOps("Map DB Second Server"))
+	assert.NoError(t, err)
+
+	request, _ := newBindJSONRequest(models.NewUser(TestEmail, "bari", "1234"), V1UsersURL, http.MethodPost)
+	respRecorder := httptest.NewRecorder()
+	first.Router.ServeHTTP(respRecorder, request)
+	assert.Equal(t, http.StatusCreated, respRecorder.Code)
+
+	_, err = first.DB.IsExistsInUsersTable(context.Background(), TestEmail)
+	assert.NoError(t, err)
+	_, err = second.DB.IsExistsInUsersTable(context.Background(), TestEmail)
+	assert.ErrorIs(t, err, models.ErrNotFound)
+
+	token, _, _ := first.Tokens.NewAccessToken(models.NewUserID(), nil)
+	_, err = second.Tokens.ParseAccessToken(token)
+	assert.Error(t, err)
+	assert.Empty(t, first.Admins)
+	assert.True(t, second.Admins[AdminEmail])
+}
+
+func TestServer_Run(t *testing.T) {
+	server := newTestServer(t, db.NewTestMapOps("Map DB Run Test"))
+	server.Config.ShutdownDelay = 0
+	server.Config.CertFile, server.Config.KeyFile, server.Config.Port = CertFileTest, KeyFileTest, ":0"
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NoError(t, server.Run(ctx))
+	server.Config.CertFile = "missing.crt"
+	assert.Error(t, server.Run(context.Background()))
+}
+
+func TestServer_Serve(t *testing.T) {
+	server := newTestServer(t, db.NewTestMapOps("Map DB Serve Test"))
+	server.Config.ShutdownDelay = 100 * time.Millisecond
+	started := make(chan struct{})
+	server.Router.GET("/slow", func(ctx *gin.Context) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		ctx.String(http.StatusOK, "done")
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	url := "http://" + ln.Addr().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- server.Serve(ctx, ln)
+	}()
+
+	// The in-flight request is drained while the server isn't ready
+	slow := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(url + "/slow")
+		if err != nil {
+			slow <- 0
+			return
+		}
+		resp.Body.Close()
+		slow <- resp.StatusCode
+	}()
+	<-started
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	resp, err := http.Get(url + ReadyzURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, http.StatusOK, <-slow)
+	assert.NoError(t, <-stopped)
+	_, err = http.Get(url + HealthzURL)
+	assert.Error(t, err)
+}
+
+func TestServer_Serve_DrainTimeout(t *testing.T) {
+	server := newTestServer(t, db.NewTestMapOps("Map DB Drain Test"))
+	server.Config.ShutdownDelay, server.Config.DrainTimeout = 0, 50*time.Millisecond
+	started := make(chan struct{})
+	server.Router.GET("/stuck", func(ctx *gin.Context) {
+		close(started)
+		<-ctx.Request.Context().Done()
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- server.Serve(ctx, ln)
+	}()
+	go http.Get("http://" + ln.Addr().String() + "/stuck")
+	<-started
+	cancel()
+	// The stuck request is cut off after the drain timeout
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve() didn't stop after the drain timeout")
+	}
+}
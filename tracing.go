@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+const (
+	ServiceName = "gin_CRUD_server"
+
+	// The exporters of the spans
+	TracingNone   = "none"
+	TracingOTLP   = "otlp"
+	TracingStdout = "stdout"
+)
+
+// newTracerProvider returns the tracer provider exporting the spans to the OTLP/HTTP collector of the
+// endpoint, or as JSON to out (stdout), or nowhere. The spans are created even when they aren't
+// exported, so the traceparent of the requests is still propagated
+func newTracerProvider(exporter, endpoint string, out io.Writer) (*sdktrace.TracerProvider, error) {
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceNameKey.String(ServiceName))),
+	}
+	switch exporter {
+	case "", TracingNone:
+	case TracingOTLP:
+		otlpOptions, err := otlpOptions(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		spanExporter, err := otlptracehttp.New(context.Background(), otlpOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot create the OTLP exporter: %s\n", err)
+		}
+		options = append(options, sdktrace.WithBatcher(spanExporter))
+	case TracingStdout:
+		spanExporter, err := stdouttrace.New(stdouttrace.WithWriter(out))
+		if err != nil {
+			return nil, fmt.Errorf("Cannot create the stdout exporter: %s\n", err)
+		}
+		options = append(options, sdktrace.WithSyncer(spanExporter))
+	default:
+		return nil, fmt.Errorf("Unsupported tracing exporter %q\n", exporter)
+	}
+	return sdktrace.NewTracerProvider(options...), nil
+}
+
+// otlpOptions returns the options of the OTLP/HTTP exporter sending the spans to the collector of the
+// endpoint URL (http://localhost:4318), the spans are sent without TLS to an http URL
+func otlpOptions(endpoint string) ([]otlptracehttp.Option, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("Invalid OTLP endpoint %q, it must be a URL like http://localhost:4318\n", endpoint)
+	}
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	if u.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	if u.Path != "" && u.Path != "/" {
+		options = append(options, otlptracehttp.WithURLPath(u.Path))
+	}
+	return options, nil
+}
+
+// Tracing starts the server span of the request, continuing the trace of its W3C traceparent header.
+// The probes and the metrics scrapes aren't traced
+func (s *Server) Tracing() gin.HandlerFunc {
+	return otelgin.Middleware(ServiceName,
+		otelgin.WithTracerProvider(s.TracerProvider),
+		otelgin.WithPropagators(propagation.TraceContext{}),
+		otelgin.WithFilter(func(request *http.Request) bool {
+			return !isProbe(request)
+		}),
+	)
+}
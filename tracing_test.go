@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"gin_CRUD_server/db"
+	"gin_CRUD_server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	testTraceID    = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testParentSpan = "00f067aa0ba902b7"
+)
+
+func Test_newTracerProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		exporter string
+		endpoint string
+		wantErr  bool
+	}{
+		{"Creates the provider without exporter successfully", TracingNone, "", false},
+		{"Creates the provider of the stdout exporter successfully", TracingStdout, "", false},
+		{"Creates the provider of the OTLP exporter successfully", TracingOTLP, DefaultTracingEndpoint, false},
+		{"Creates the provider of the OTLP exporter with TLS and path successfully", TracingOTLP, "https://collector:4318/otlp/v1/traces", false},
+		{"Creates fail due to invalid OTLP endpoint", TracingOTLP, "localhost:4318", true},
+		{"Creates fail due to unsupported exporter", "jaeger", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := newTracerProvider(tt.exporter, tt.endpoint, &bytes.Buffer{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newTracerProvider() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if provider != nil {
+				assert.NoError(t, provider.Shutdown(context.Background()))
+			}
+		})
+	}
+}
+
+func TestServer_Tracing(t *testing.T) {
+	server := newTestServer(t, db.NewTestMapOps("Map DB Tracing Test"))
+	exporter := tracetest.NewInMemoryExporter()
+	server.TracerProvider.RegisterSpanProcessor(sdktrace.NewSimpleSpanProcessor(exporter))
+	id := models.NewUserID()
+	tests := []struct {
+		name        string
+		url         string
+		traceparent string
+		wantSpan    string
+	}{
+		{"Continues the trace of the traceparent", V1UsersURL + "/" + id, "00-" + testTraceID + "-" + testParentSpan + "-01", "/v1/users/:id"},
+		{"Starts a new trace without traceparent", ListURL, "", ListURL},
+		{"Doesn't trace the probes", HealthzURL, "", ""},
+		{"Doesn't trace the metrics", MetricsURL, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+			respRecorder, router := createRouterAndWriter()
+			server.registerRoutes(router)
+			request, _ := createNewRequest(http.MethodGet, tt.url, "", nil)
+			if tt.traceparent != "" {
+				request.Header.Set("traceparent", tt.traceparent)
+			}
+			router.ServeHTTP(respRecorder, request)
+			spans := exporter.GetSpans()
+			if tt.wantSpan == "" {
+				assert.Empty(t, spans)
+				return
+			}
+			require.Len(t, spans, 1)
+			assert.Equal(t, tt.wantSpan, spans[0].Name)
+			assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind)
+			if tt.traceparent != "" {
+				assert.Equal(t, testTraceID, spans[0].SpanContext.TraceID().String())
+				assert.Equal(t, testParentSpan, spans[0].Parent.SpanID().String())
+			} else {
+				assert.False(t, spans[0].Parent.IsValid())
+			}
+		})
+	}
+}
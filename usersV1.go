@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"gin_CRUD_server/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	V1UsersURL = "/v1/users"
+	V1UserURL  = "/v1/users/:id"
+	IDParam    = "id"
+)
+
+type userReplacement struct {
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+type emailChange struct {
+	Email string `json:"email"`
+	// CurrentPassword re-authenticates the users changing their own email
+	CurrentPassword string `json:"current_password,omitempty"`
+}
+
+// registerV1Routes registers the /v1/users resource routes, the user is identified
+// by its ID (or by its email for compatibility) in the path
+func (s *Server) registerV1Routes(router *gin.Engine) {
+	router.POST(V1UsersURL, s.CreateUserV1Handler)
+	authorized := router.Group(V1UsersURL, s.RequireAuth)
+	authorized.GET("", RequirePermission(models.PermissionListUsers), s.ListUsersHandler)
+	authorized.GET("/:id", RequireSelfOrPermission(models.PermissionReadUsers, idFromPath), s.GetUserV1Handler)
+	authorized.PUT("/:id", RequireSelfOrPermission(models.PermissionUpdateUsers, idFromPath), s.ReplaceUserV1Handler)
+	authorized.PATCH("/:id", RequireSelfOrPermission(models.PermissionUpdateUsers, idFromPath), s.PatchUserV1Handler)
+	authorized.DELETE("/:id", RequireSelfOrPermission(models.PermissionDeleteUsers, idFromPath), s.DeleteUserV1Handler)
+	authorized.PUT("/:id/email", RequireSelfOrPermission(models.PermissionUpdateUsers, idFromPath), s.ChangeEmailV1Handler)
+}
+
+// CreateUserV1Handler creates a new user and returns it with its location
+func (s *Server) CreateUserV1Handler(ctx *gin.Context) {
+	user, err := getUserFromBindJSON(ctx)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	if err = s.addUser(ctx.Request.Context(), user); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	s.respondWithUser(ctx, http.StatusCreated, user.ID)
+}
+
+// GetUserV1Handler returns the user of the path
+func (s *Server) GetUserV1Handler(ctx *gin.Context) {
+	user, ok := s.getUserFromPath(ctx)
+	if !ok {
+		return
+	}
+	if _, ok = checkPreconditions(ctx, user); !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, user.WithoutPassword())
+}
+
+// ReplaceUserV1Handler replaces the username & password of the user of the path
+func (s *Server) ReplaceUserV1Handler(ctx *gin.Context) {
+	user, ok := s.getUserFromPath(ctx)
+	if !ok {
+		return
+	}
+	version, ok := checkPreconditions(ctx, user)
+	if !ok {
+		return
+	}
+	req := userReplacement{}
+	if err := bindJSON(ctx, &req); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	fields := requiredFields(map[string]string{"name": req.Name, "password": req.Password})
+	if req.Email != "" && !strings.EqualFold(req.Email, user.Email) {
+		fields = append(fields, models.FieldError{Field: "email", Code: models.CodeFieldReadOnly, Message: "the email can be changed only by PUT " + V1UserURL + "/email"})
+	}
+	if len(fields) > 0 {
+		respondWithError(ctx, models.NewValidationError(fields...))
+		return
+	}
+	if err := s.updateUser(ctx.Request.Context(), &models.User{Email: user.Email, Name: req.Name, Password: req.Password, Version: version}); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	s.respondWithUser(ctx, http.StatusOK, user.ID)
+}
+
+// PatchUserV1Handler updates only the fields of the user present in the patch, the body is a
+// JSON merge patch (RFC 7396, also for application/json) or a JSON patch (RFC 6902)
+func (s *Server) PatchUserV1Handler(ctx *gin.Context) {
+	user, ok := s.getUserFromPath(ctx)
+	if !ok {
+		return
+	}
+	version, ok := checkPreconditions(ctx, user)
+	if !ok {
+		return
+	}
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		abortWithProblem(ctx, models.CodeInvalidRequest, "cannot read the body: %s", err)
+		return
+	}
+	var patch *models.UserPatch
+	switch ctx.ContentType() {
+	case models.MergePatchContentType, gin.MIMEJSON:
+		patch, err = models.NewMergePatch(*user, body)
+	case models.JSONPatchContentType:
+		patch, err = models.NewJSONPatch(*user, body)
+	default:
+		ctx.Header("Accept-Patch", models.MergePatchContentType+", "+models.JSONPatchContentType)
+		abortWithProblem(ctx, models.CodeUnsupportedMediaType, "the content type %q isn't supported", ctx.ContentType())
+		return
+	}
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	if patch.Password != nil {
+		hash, err := s.Passwords.Hash(*patch.Password)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		patch.Password = &hash
+	}
+	if !patch.IsEmpty() {
+		patch.Version = version
+		if err = s.DB.PatchUser(ctx.Request.Context(), user.ID, *patch); err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+	}
+	s.respondWithUser(ctx, http.StatusOK, user.ID)
+}
+
+// DeleteUserV1Handler deletes the user of the path
+func (s *Server) DeleteUserV1Handler(ctx *gin.Context) {
+	user, ok := s.getUserFromPath(ctx)
+	if !ok {
+		return
+	}
+	version, ok := checkPreconditions(ctx, user)
+	if !ok {
+		return
+	}
+	if err := s.DB.DeleteUserByID(ctx.Request.Context(), user.ID, version); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// ChangeEmailV1Handler changes the email of the user of the path, the user keeps its ID
+// so its tokens, roles and the URLs using the ID are not affected. The users changing their own
+// email must send their current password, and the emails of the bootstrap admins are reserved
+// since the new email isn't verified
+func (s *Server) ChangeEmailV1Handler(ctx *gin.Context) {
+	user, ok := s.getUserFromPath(ctx)
+	if !ok {
+		return
+	}
+	version, ok := checkPreconditions(ctx, user)
+	if !ok {
+		return
+	}
+	req := emailChange{}
+	if err := bindJSON(ctx, &req); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	if _, err := mail.ParseAddress(req.Email); err != nil {
+		respondWithError(ctx, models.NewValidationError(models.FieldError{Field: "email", Code: models.CodeFieldInvalid, Message: "the email is invalid"}))
+		return
+	}
+	if s.Admins[strings.ToLower(req.Email)] {
+		respondWithError(ctx, models.NewValidationError(models.FieldError{Field: "email", Code: models.CodeFieldUnsupportedValue, Message: "the email is reserved"}))
+		return
+	}
+	if principal := getPrincipal(ctx); principal != nil && principal.ID == user.ID {
+		if req.CurrentPassword == "" {
+			respondWithError(ctx, models.NewValidationError(models.FieldError{Field: "current_password", Code: models.CodeFieldRequired, Message: "the current password is required to change your email"}))
+			return
+		}
+		if _, err := s.Passwords.Verify(req.CurrentPassword, user.Password); err != nil {
+			abortWithProblem(ctx, models.CodeForbidden, "the current password is invalid")
+			return
+		}
+	}
+	if err := s.DB.ChangeEmail(ctx.Request.Context(), user.ID, req.Email, version); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	s.respondWithUser(ctx, http.StatusOK, user.ID)
+}
+
+// Deprecated marks the legacy route as deprecated and links to its successor
+func Deprecated(successor string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("Deprecation", "true")
+		ctx.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+		ctx.Next()
+	}
+}
+
+// respondWithUser returns the user without its password with its ETag, and its location when it was created
+func (s *Server) respondWithUser(ctx *gin.Context, status int, id string) {
+	user, err := s.DB.GetUserByID(ctx.Request.Context(), id)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	if status == http.StatusCreated {
+		ctx.Header("Location", V1UsersURL+"/"+user.ID)
+	}
+	ctx.Header("ETag", user.ETag())
+	ctx.JSON(status, user.WithoutPassword())
+}
+
+// getUserFromPath returns the user of the path, or responds with the error and returns false
+func (s *Server) getUserFromPath(ctx *gin.Context) (*models.User, bool) {
+	user, err := s.findUser(ctx.Request.Context(), idFromPath(ctx))
+	if err != nil {
+		respondWithError(ctx, err)
+		return user, false
+	}
+	return user, true
+}
+
+// findUser returns the user according to its ID or email
+func (s *Server) findUser(ctx context.Context, id string) (*models.User, error) {
+	if models.IsUserID(id) {
+		return s.DB.GetUserByID(ctx, id)
+	}
+	if _, err := mail.ParseAddress(id); err != nil {
+		return &models.User{}, models.NewValidationError(models.FieldError{Field: IDParam, Code: models.CodeFieldInvalid, Message: "the user ID must be a UUID or an email"})
+	}
+	return s.DB.IsExistsInUsersTable(ctx, id)
+}
+
+// idFromPath returns the target user ID from the path
+func idFromPath(ctx *gin.Context) string {
+	return ctx.Param(IDParam)
+}
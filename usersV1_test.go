@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"gin_CRUD_server/db"
+	"gin_CRUD_server/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsersV1Handlers(t *testing.T) {
+	server := newTestServer(t, db.NewTestMapOps("Map DB V1 Test"))
+	server.Admins = newAdmins(AdminEmail)
+	otherEmail, newEmail := "other@gmail.com", "new@gmail.com"
+	server.DB.InsertNewUser(context.Background(), *models.NewUser(otherEmail, "other", "1234"))
+	hash, _ := server.Passwords.Hash("1234")
+	user := models.NewUser(TestEmail, "bari", hash)
+	server.DB.InsertNewUser(context.Background(), *user)
+	userToken, _, _ := server.Tokens.NewAccessToken(user.ID, nil)
+	userURL := V1UsersURL + "/" + user.ID
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		body     interface{}
+		wantCode int
+		wantName string
+	}{
+		{"Creates fail due to invalid email", http.MethodPost, V1UsersURL, models.NewUser("abc", "bari", "1234"), http.StatusUnprocessableEntity, ""},
+		{"Creates a new user successfully", http.MethodPost, V1UsersURL, models.NewUser(newEmail, "new", "1234"), http.StatusCreated, "new"},
+		{"Creates fail due to the email of an existing user in another case", http.MethodPost, V1UsersURL, models.NewUser(strings.ToUpper(newEmail), "new", "1234"), http.StatusConflict, ""},
+		{"Gets the user successfully", http.MethodGet, userURL, nil, http.StatusOK, "bari"},
+		{"Gets the user by its email successfully", http.MethodGet, V1UsersURL + "/" + TestEmail, nil, http.StatusOK, "bari"},
+		{"Gets fail due to invalid ID", http.MethodGet, V1UsersURL + "/abc", nil, http.StatusForbidden, ""},
+		{"Gets fail due to another user", http.MethodGet, V1UsersURL + "/" + otherEmail, nil, http.StatusForbidden, ""},
+		{"Replaces fail due to missing password", http.MethodPut, userURL, userReplacement{Name: "bari2"}, http.StatusUnprocessableEntity, ""},
+		{"Replaces fail due to email of another user", http.MethodPut, userURL, userReplacement{otherEmail, "bari2", "1"}, http.StatusUnprocessableEntity, ""},
+		{"Replaces the user successfully", http.MethodPut, userURL, userReplacement{Name: "bari2", Password: "12345"}, http.StatusOK, "bari2"},
+		{"Patches fail due to empty name", http.MethodPatch, userURL, map[string]string{"name": ""}, http.StatusUnprocessableEntity, ""},
+		{"Patches only the name successfully", http.MethodPatch, userURL, map[string]string{"name": "bari3"}, http.StatusOK, "bari3"},
+		{"Logins with the replaced password kept by the patch", http.MethodPost, LoginURL, credentials{TestEmail, "12345"}, http.StatusOK, ""},
+		{"Changes the email fail due to invalid email", http.MethodPut, userURL + "/email", emailChange{"abc", "12345"}, http.StatusUnprocessableEntity, ""},
+		{"Changes the email fail due to email of another user", http.MethodPut, userURL + "/email", emailChange{"OTHER@gmail.com", "12345"}, http.StatusConflict, ""},
+		{"Changes the email fail due to another user", http.MethodPut, V1UsersURL + "/" + otherEmail + "/email", emailChange{"x@gmail.com", "12345"}, http.StatusForbidden, ""},
+		{"Changes the email fail due to missing current password", http.MethodPut, userURL + "/email", emailChange{Email: "Changed@gmail.com"}, http.StatusUnprocessableEntity, ""},
+		{"Changes the email fail due to wrong current password", http.MethodPut, userURL + "/email", emailChange{"Changed@gmail.com", "1234"}, http.StatusForbidden, ""},
+		{"Changes the email fail due to the email of a bootstrap admin", http.MethodPut, userURL + "/email", emailChange{"ADMIN@gmail.com", "12345"}, http.StatusUnprocessableEntity, ""},
+		{"Changes the email successfully", http.MethodPut, userURL + "/email", emailChange{"Changed@gmail.com", "12345"}, http.StatusOK, "bari3"},
+		{"Gets the user with the same token after the email change", http.MethodGet, userURL, nil, http.StatusOK, "bari3"},
+		{"Logins with the new email in another case", http.MethodPost, LoginURL, credentials{"changed@GMAIL.com", "12345"}, http.StatusOK, ""},
+		{"Logins fail due to the old email", http.MethodPost, LoginURL, credentials{TestEmail, "12345"}, http.StatusUnauthorized, ""},
+		{"Deletes the user successfully", http.MethodDelete, userURL, nil, http.StatusNoContent, ""},
+		{"Gets fail due to the deleted user", http.MethodGet, userURL, nil, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			respRecorder, router := createRouterAndWriter()
+			server.registerRoutes(router)
+			buf, _ := json.Marshal(tt.body)
+			request, err := createNewRequest(tt.method, tt.url, "application/json", bytes.NewBuffer(buf))
+			if err != nil {
+				t.Errorf(err.Error())
+			}
+			request.Header.Set("Authorization", BearerPrefix+userToken)
+			router.ServeHTTP(respRecorder, request)
+			assert.Equal(t, tt.wantCode, respRecorder.Code)
+			if tt.wantName != "" {
+				user := models.User{}
+				assert.NoError(t, json.Unmarshal(respRecorder.Body.Bytes(), &user))
+				assert.Equal(t, tt.wantName, user.Name)
+				assert.Empty(t, user.Password)
+			}
+			if tt.wantCode == http.StatusCreated {
+				created, _ := server.DB.IsExistsInUsersTable(context.Background(), newEmail)
+				assert.True(t, models.IsUserID(created.ID))
+				assert.Equal(t, V1UsersURL+"/"+created.ID, respRecorder.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestLegacyRoutesDeprecation(t *testing.T) {
+	server := newTestServer(t, db.NewTestMapOps("Map DB Legacy Test"))
+	respRecorder, router := createRouterAndWriter()
+	server.registerRoutes(router)
+	request, _ := newBindJSONRequest(models.NewUser(TestEmail, "bari", "1234"), URL, http.MethodPut)
+	router.ServeHTTP(respRecorder, request)
+	assert.Equal(t, http.StatusOK, respRecorder.Code)
+	assert.Equal(t, "true", respRecorder.Header().Get("Deprecation"))
+	assert.Contains(t, respRecorder.Header().Get("Link"), V1UsersURL)
+}
+
+func TestPatchUserV1Handler(t *testing.T) {
+	server := newTestServer(t, db.NewTestMapOps("Map DB Patch Test"))
+	hash, _ := server.Passwords.Hash("1234")
+	user := models.NewUser(TestEmail, "bari", hash)
+	server.DB.InsertNewUser(context.Background(), *user)
+	userToken, _, _ := server.Tokens.NewAccessToken(user.ID, nil)
+
+	tests := []struct {
+		name        string
+		url         string
+		contentType string
+		body        string
+		wantCode    int
+		wantName    string
+	}{
+		{"Patches the name by a merge patch successfully", V1UsersURL + "/" + user.ID, models.MergePatchContentType, `{"name": "bari2"}`, http.StatusOK, "bari2"},
+		{"Patches the name by a JSON body successfully", V1UsersURL + "/" + user.ID, "application/json", `{"name": "bari3"}`, http.StatusOK, "bari3"},
+		{"Patches the name by a JSON patch successfully", V1UsersURL + "/" + user.ID, models.JSONPatchContentType, `[{"op": "test", "path": "/name", "value": "bari3"}, {"op": "replace", "path": "/name", "value": "bari4"}]`, http.StatusOK, "bari4"},
+		{"Patches by the legacy route successfully", URL + "/" + user.ID, models.MergePatchContentType, `{"password": "12345"}`, http.StatusOK, "bari4"},
+		{"Patches fail due to failed test", V1UsersURL + "/" + user.ID, models.JSONPatchContentType, `[{"op": "test", "path": "/name", "value": "bari"}]`, http.StatusConflict, ""},
+		{"Patches fail due to removing the password", V1UsersURL + "/" + user.ID, models.MergePatchContentType, `{"password": null}`, http.StatusUnprocessableEntity, ""},
+		{"Patches fail due to unsupported content type", V1UsersURL + "/" + user.ID, "text/plain", `name=bari5`, http.StatusUnsupportedMediaType, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			respRecorder, router := createRouterAndWriter()
+			server.registerRoutes(router)
+			request, err := createNewRequest(http.MethodPatch, tt.url, tt.contentType, bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Errorf(err.Error())
+			}
+			request.Header.Set("Authorization", BearerPrefix+userToken)
+			router.ServeHTTP(respRecorder, request)
+			assert.Equal(t, tt.wantCode, respRecorder.Code)
+			if tt.wantName != "" {
+				patched := models.User{}
+				assert.NoError(t, json.Unmarshal(respRecorder.Body.Bytes(), &patched))
+				assert.Equal(t, tt.wantName, patched.Name)
+			}
+		})
+	}
+	// The password is only changed by the patch including it
+	_, err := server.verifyUserPassword(context.Background(), TestEmail, "12345")
+	assert.NoError(t, err)
+}
+
+func TestUserPreconditions(t *testing.T) {
+	server := newTestServer(t, db.NewTestMapOps("Map DB Preconditions Test"))
+	user := models.NewUser(TestEmail, "bari", "1234")
+	server.DB.InsertNewUser(context.Background(), *user)
+	userToken, _, _ := server.Tokens.NewAccessToken(user.ID, nil)
+	userURL := V1UsersURL + "/" + user.ID
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		header   string
+		value    string
+		body     string
+		wantCode int
+		wantETag string
+	}{
+		{"Gets the user with its ETag", http.MethodGet, userURL, "", "", "", http.StatusOK, `"1"`},
+		{"Gets not modified due to matching If-None-Match", http.MethodGet, userURL, "If-None-Match", `"0", W/"1"`, "", http.StatusNotModified, `"1"`},
+		{"Gets the user due to other If-None-Match", http.MethodGet, userURL, "If-None-Match", `"0"`, "", http.StatusOK, `"1"`},
+		{"Patches the user due to matching If-Match", http.MethodPatch, userURL, "If-Match", `"1"`, `{"name": "bari2"}`, http.StatusOK, `"2"`},
+		{"Patches fail due to stale If-Match", http.MethodPatch, userURL, "If-Match", `"1"`, `{"name": "bari3"}`, http.StatusPreconditionFailed, `"2"`},
+		{"Patches fail due to weak If-Match", http.MethodPatch, userURL, "If-Match", `W/"2"`, `{"name": "bari3"}`, http.StatusPreconditionFailed, `"2"`},
+		{"Replaces fail due to If-None-Match", http.MethodPut, userURL, "If-None-Match", "*", `{"name": "bari3", "password": "1"}`, http.StatusPreconditionFailed, `"2"`},
+		{"Replaces the user due to any If-Match", http.MethodPut, userURL, "If-Match", "*", `{"name": "bari3", "password": "1"}`, http.StatusOK, `"3"`},
+		{"Changes the email fail due to stale If-Match", http.MethodPut, userURL + "/email", "If-Match", `"2"`, `{"email": "a@gmail.com"}`, http.StatusPreconditionFailed, `"3"`},
+		{"Updates fail by the legacy route due to stale If-Match", http.MethodPost, URL, "If-Match", `"2"`, `{"email": "` + TestEmail + `", "name": "bari4", "password": "1"}`, http.StatusPreconditionFailed, `"3"`},
+		{"Deletes fail due to stale If-Match", http.MethodDelete, userURL, "If-Match", `"2"`, "", http.StatusPreconditionFailed, `"3"`},
+		{"Deletes the user due to matching If-Match", http.MethodDelete, userURL, "If-Match", `"3"`, "", http.StatusNoContent, `"3"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			respRecorder, router := createRouterAndWriter()
+			server.registerRoutes(router)
+			request, err := createNewRequest(tt.method, tt.url, "application/json", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Errorf(err.Error())
+			}
+			request.Header.Set("Authorization", BearerPrefix+userToken)
+			if tt.header != "" {
+				request.Header.Set(tt.header, tt.value)
+			}
+			router.ServeHTTP(respRecorder, request)
+			assert.Equal(t, tt.wantCode, respRecorder.Code)
+			assert.Equal(t, tt.wantETag, respRecorder.Header().Get("ETag"))
+		})
+	}
+}
+
+func TestUserVersionConflict(t *testing.T) {
+	server := newTestServer(t, db.NewTestMapOps("Map DB Version Test"))
+	user := models.NewUser(TestEmail, "bari", "1234")
+	server.DB.InsertNewUser(context.Background(), *user)
+	name := "bari2"
+	// The version is checked by the DB so a concurrent change between the precondition and the update is detected
+	assert.NoError(t, server.DB.PatchUser(context.Background(), user.ID, models.UserPatch{Name: &name, Version: 1}))
+	assert.Equal(t, models.ErrVersionConflict, server.DB.PatchUser(context.Background(), user.ID, models.UserPatch{Name: &name, Version: 1}))
+	assert.Equal(t, models.ErrVersionConflict, server.DB.UpdateNameAndPassUser(context.Background(), models.User{Email: TestEmail, Name: name, Version: 1}))
+	assert.Equal(t, models.ErrVersionConflict, server.DB.ChangeEmail(context.Background(), user.ID, "a@gmail.com", 1))
+	assert.Equal(t, models.ErrVersionConflict, server.DB.DeleteUserByID(context.Background(), user.ID, 1))
+	assert.NoError(t, server.DB.GrantRole(context.Background(), TestEmail, models.RoleSupport))
+	updated, _ := server.DB.GetUserByID(context.Background(), user.ID)
+	assert.Equal(t, int64(3), updated.Version)
+	assert.Equal(t, models.ErrUserNotFound, server.DB.DeleteUserByID(context.Background(), models.NewUserID(), 0))
+}